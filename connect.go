@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	vole "github.com/ipfs-shipyard/vole/lib"
+	"github.com/urfave/cli/v2"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// runConnectPhases dials each address of the peer and prints a table, or JSON lines, of how long each phase of the connection setup took
+func runConnectPhases(c *cli.Context, ai *peer.AddrInfo) error {
+	if c.Duration("timeout") <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		vole.MeasureConnectPhases(c.Context, ai, c.Duration("timeout"), func(r *vole.ConnectPhases) {
+			_ = enc.Encode(r)
+		})
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDRESS\tDIALED\tDNS\tTRANSPORT\tSECURITY\tMUXER\tFIRST STREAM\tTOTAL")
+	vole.MeasureConnectPhases(c.Context, ai, c.Duration("timeout"), func(r *vole.ConnectPhases) {
+		dialed := "-"
+		if r.DialedAddr != nil {
+			dialed = r.DialedAddr.String()
+		}
+		if r.Error != nil {
+			fmt.Fprintf(tw, "%s\t%s\terror: %s\n", r.Addr, dialed, oneLineErr(r.Error))
+			return
+		}
+		security := formatPhase(r.SecurityHandshake, string(r.Security))
+		muxer := formatPhase(r.MuxerNegotiation, string(r.Muxer))
+		if r.EarlyMuxer {
+			muxer = fmt.Sprintf("in security (%s)", r.Muxer)
+		}
+		if r.Combined {
+			security = fmt.Sprintf("in transport (%s)", orNone(string(r.Security)))
+			muxer = fmt.Sprintf("in transport (%s)", orNone(string(r.Muxer)))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Addr, dialed, r.DNS, formatPhase(r.TransportHandshake, r.Transport),
+			security, muxer, r.FirstStream, r.Total)
+	})
+	return tw.Flush()
+}
+
+func formatPhase(d time.Duration, name string) string {
+	return fmt.Sprintf("%s (%s)", d, name)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	vole "github.com/ipfs-shipyard/vole/lib"
+	"github.com/urfave/cli/v2"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+var dhtCheckCmd = &cli.Command{
+	Name:      "check",
+	ArgsUsage: "[<multibase-bytes-key>] [<multiaddr>]",
+	Usage:     "compare a record or provider set across DHT nodes",
+	Description: `creates a libp2p peer, looks up the K closest peers to the key starting from the target and sends each of them a GET_VALUE (or GET_PROVIDERS with --providers) request.
+Prints a table of which nodes hold the record, which version of it they hold and which are missing it.
+With --node the given nodes are queried instead of looking up the closest peers and the multiaddr argument is not needed.
+The key can be given as typed flags instead of multibase bytes.`,
+	Action: func(c *cli.Context) error {
+		client, kind, key, nodes, err := dhtCheckSetup(c)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		results := client.QueryNodes(c.Context, kind, key, nodes)
+		printDhtCheckResults(kind, results)
+		return nil
+	},
+	Flags: dhtCheckFlags,
+}
+
+var dhtCheckFlags = append([]cli.Flag{
+	&cli.StringFlag{
+		Name:        "protocolID",
+		Usage:       "the protocol ID",
+		DefaultText: "/ipfs/kad/1.0.0",
+		Value:       "/ipfs/kad/1.0.0",
+	},
+	&cli.BoolFlag{
+		Name:        "providers",
+		Usage:       "compare provider records instead of values",
+		DefaultText: "false",
+		Value:       false,
+	},
+	&cli.IntFlag{
+		Name:        "count",
+		Aliases:     []string{"k"},
+		Usage:       "how many of the closest peers to the key to query",
+		DefaultText: "20",
+		Value:       20,
+	},
+	&cli.StringSliceFlag{
+		Name:  "node",
+		Usage: "multiaddr of a node to query instead of looking up the closest peers, may be repeated",
+	},
+}, append(dhtKeyFlags, dhtRequestFlags...)...)
+
+// dhtCheckSetup parses the key and nodes shared by the check and watch commands, connects a client and finds the nodes to query.
+// The returned client must be closed.
+func dhtCheckSetup(c *cli.Context) (*vole.DhtClient, vole.DhtQueryKind, []byte, []peer.AddrInfo, error) {
+	var nodes []peer.AddrInfo
+	for _, s := range c.StringSlice("node") {
+		ai, err := peer.AddrInfoFromString(s)
+		if err != nil {
+			return nil, "", nil, nil, err
+		}
+		nodes = append(nodes, *ai)
+	}
+
+	kind := vole.DhtQueryValue
+	peerKeyType := vole.DhtKeyIPNS
+	if c.Bool("providers") {
+		kind = vole.DhtQueryProviders
+		peerKeyType = vole.DhtKeyPeer
+	}
+
+	nArgs := 1
+	if len(nodes) > 0 {
+		nArgs = 0
+	}
+	key, args, err := dhtKeyAndArgs(c, nArgs, peerKeyType)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+
+	var entry *peer.AddrInfo
+	if len(args) > 0 {
+		entry, err = peer.AddrInfoFromString(args[0])
+		if err != nil {
+			return nil, "", nil, nil, err
+		}
+	} else {
+		entry = &nodes[0]
+	}
+
+	client, err := vole.NewDhtClient(c.Context, protocol.ID(c.String("protocolID")), entry, dhtOptions(c)...)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+
+	if len(nodes) == 0 {
+		nodes, err = client.ClosestPeers(c.Context, key, c.Int("count"))
+		if err != nil {
+			_ = client.Close()
+			return nil, "", nil, nil, err
+		}
+	}
+	return client, kind, key, nodes, nil
+}
+
+func printDhtCheckResults(kind vole.DhtQueryKind, results []*vole.DhtNodeResult) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if kind == vole.DhtQueryProviders {
+		fmt.Fprintln(tw, "PEER\tSTATUS\tPROVIDERS")
+	} else {
+		fmt.Fprintln(tw, "PEER\tSTATUS\tSEQUENCE\tVALUE")
+	}
+
+	holders := 0
+	versions := make(map[string]struct{})
+	for _, r := range results {
+		status := "missing"
+		switch {
+		case !r.Responded:
+			status = "error: " + oneLineErr(r.Error)
+		case r.Holds():
+			status = "present"
+			holders++
+		}
+
+		if kind == vole.DhtQueryProviders {
+			provs := make([]string, 0, len(r.Providers))
+			for _, p := range r.Providers {
+				provs = append(provs, p.ID.String())
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Peer, status, strings.Join(provs, ","))
+			continue
+		}
+
+		seq := ""
+		if r.Sequence != nil {
+			seq = fmt.Sprint(*r.Sequence)
+		}
+		if r.Holds() {
+			versions[r.ValueDigest] = struct{}{}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Peer, status, seq, r.ValueDigest)
+	}
+	_ = tw.Flush()
+
+	if kind == vole.DhtQueryProviders {
+		fmt.Printf("%d of %d nodes hold provider records\n", holders, len(results))
+		return
+	}
+	fmt.Printf("%d of %d nodes hold the record, %d distinct versions\n", holders, len(results), len(versions))
+}
+
+// oneLineErr returns the message of the error on a single line, so that errors listing every failed dial fit in a table row
+func oneLineErr(err error) string {
+	return strings.Join(strings.Fields(err.Error()), " ")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	vole "github.com/ipfs-shipyard/vole/lib"
+	"github.com/urfave/cli/v2"
+
+	"github.com/multiformats/go-multibase"
+)
+
+var dhtKeyFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "cid",
+		Usage: "use the multihash of the CID as the key instead of the key argument",
+	},
+	&cli.StringFlag{
+		Name:  "peer",
+		Usage: "use the peer ID as the key instead of the key argument",
+	},
+	&cli.StringFlag{
+		Name:  "ipns",
+		Usage: "use the /ipns/ record key of the IPNS name (a peer ID, optionally prefixed with /ipns/) instead of the key argument",
+	},
+	&cli.StringFlag{
+		Name:  "pk",
+		Usage: "use the /pk/ public key record key of the peer ID instead of the key argument",
+	},
+	&cli.BoolFlag{
+		Name:        "auto",
+		Usage:       "detect whether the key argument is an /ipns/ or /pk/ path, peer ID, CID or multibase bytes instead of only accepting multibase bytes, a base58 Qm... value is taken as a CID rather than an RSA peer ID",
+		DefaultText: "false",
+		Value:       false,
+	},
+}
+
+// dhtKeyAndArgs returns the key given by one of the dhtKeyFlags or the first argument, along with the nArgs arguments that follow it.
+// Bare peer IDs detected by --auto are turned into peerKeyType keys.
+func dhtKeyAndArgs(c *cli.Context, nArgs int, peerKeyType vole.DhtKeyType) ([]byte, []string, error) {
+	var key []byte
+	keyFlagsSet := 0
+	for _, f := range []struct {
+		name string
+		typ  vole.DhtKeyType
+	}{
+		{"cid", vole.DhtKeyCID},
+		{"peer", vole.DhtKeyPeer},
+		{"ipns", vole.DhtKeyIPNS},
+		{"pk", vole.DhtKeyPK},
+	} {
+		if !c.IsSet(f.name) {
+			continue
+		}
+		keyFlagsSet++
+		var err error
+		key, err = vole.DhtKey(f.typ, c.String(f.name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --%s: %w", f.name, err)
+		}
+	}
+	if keyFlagsSet > 1 {
+		return nil, nil, fmt.Errorf("only one of --cid, --peer, --ipns and --pk may be given")
+	}
+
+	args := c.Args().Slice()
+	if keyFlagsSet == 1 {
+		if len(args) != nArgs {
+			return nil, nil, fmt.Errorf("invalid number of arguments")
+		}
+		return key, args, nil
+	}
+
+	if len(args) != nArgs+1 {
+		return nil, nil, fmt.Errorf("invalid number of arguments")
+	}
+	var err error
+	if c.Bool("auto") {
+		key, _, err = vole.AutoDhtKey(args[0], peerKeyType)
+	} else {
+		_, key, err = multibase.Decode(args[0])
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, args[1:], nil
+}
+
+const dhtKeySpecUsage = `Keys are given as <type>:<value> where type is one of
+	cid   - a CID, keyed by its multihash as for provider records
+	mh    - a multihash in base58 or multibase
+	peer  - a peer ID
+	ipns  - an IPNS name (a peer ID, optionally prefixed with /ipns/), keyed as /ipns/<peer ID bytes>
+	pk    - a peer ID, keyed as /pk/<peer ID bytes>
+	mb    - multibase encoded key bytes
+	str   - the raw string
+	auto  - detect the type of the value
+values without a type prefix are treated as raw strings.`
+
+var dhtKeyCmd = &cli.Command{
+	Name:  "key",
+	Usage: "tools for working with DHT keys and the kademlia keyspace",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "id",
+			ArgsUsage:   "<key>",
+			Usage:       "print the DHT key bytes and kademlia ID of a key",
+			Description: "converts the key into the bytes used on the wire and the SHA-256 kademlia ID they are placed at in the keyspace.\n" + dhtKeySpecUsage,
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return fmt.Errorf("invalid number of arguments")
+				}
+
+				enc, err := multibase.EncoderByName(c.String("base"))
+				if err != nil {
+					return err
+				}
+
+				key, err := vole.ParseDhtKeySpec(c.Args().First())
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("Key: %s\n", enc.Encode(key))
+				fmt.Printf("Kademlia ID: %s\n", hex.EncodeToString(vole.KadID(key)))
+				return nil
+			},
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "base",
+					Aliases:     []string{"b"},
+					Usage:       "multibase to encode the key bytes in (e.g. b or base32 for base32 encoding)",
+					DefaultText: "base32",
+					Value:       "base32",
+				},
+			},
+		},
+		{
+			Name:        "distance",
+			ArgsUsage:   "<key> <key>",
+			Usage:       "print the XOR distance and common prefix length between two keys",
+			Description: "compares the kademlia IDs of the two keys.\n" + dhtKeySpecUsage,
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 2 {
+					return fmt.Errorf("invalid number of arguments")
+				}
+
+				a, err := vole.ParseDhtKeySpec(c.Args().Get(0))
+				if err != nil {
+					return err
+				}
+				b, err := vole.ParseDhtKeySpec(c.Args().Get(1))
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("XOR distance: %s\n", hex.EncodeToString(vole.KadDistance(a, b)))
+				fmt.Printf("Common prefix length: %d\n", vole.KadCommonPrefixLen(a, b))
+				return nil
+			},
+		},
+	},
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	vole "github.com/ipfs-shipyard/vole/lib"
+	"github.com/urfave/cli/v2"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+var dhtModeCmd = &cli.Command{
+	Name:      "mode",
+	ArgsUsage: "<multiaddr>",
+	Usage:     "check whether a peer is acting as a DHT server",
+	Description: `connects to the target and runs identify to see whether it advertises the DHT protocol.
+If it does, a DHT PING and FIND_NODE request are sent to confirm it answers.
+Reports "server", "client-only" or "advertises but does not answer", or the whole result as JSON with --json.`,
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return fmt.Errorf("invalid number of arguments")
+		}
+		ai, err := peer.AddrInfoFromString(c.Args().First())
+		if err != nil {
+			return err
+		}
+		protoID := protocol.ID(c.String("protocolID"))
+
+		res, err := vole.ProbeDhtMode(c.Context, protoID, ai, dhtOptions(c)...)
+		if err != nil {
+			return err
+		}
+
+		if c.Bool("json") {
+			jsOut, err := json.Marshal(res)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\n", jsOut)
+			return nil
+		}
+
+		fmt.Printf("PeerID: %q\n", res.PeerId)
+		fmt.Printf("Agent version: %q\n", res.AgentVersion)
+		fmt.Printf("Advertises %s: %t\n", protoID, res.Advertised)
+		if res.Advertised {
+			if res.PingErr != nil {
+				fmt.Printf("PING: %v\n", res.PingErr)
+			} else {
+				fmt.Printf("PING: answered in %s\n", res.PingRTT)
+			}
+			if res.FindNodeErr != nil {
+				fmt.Printf("FIND_NODE: %v\n", res.FindNodeErr)
+			} else {
+				fmt.Printf("FIND_NODE: answered with %d closer peers\n", res.CloserPeers)
+			}
+		}
+		fmt.Printf("Mode: %s\n", res.Mode)
+		return nil
+	},
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:        "protocolID",
+			Usage:       "the protocol ID",
+			DefaultText: "/ipfs/kad/1.0.0",
+			Value:       "/ipfs/kad/1.0.0",
+		},
+		&cli.BoolFlag{
+			Name:        "json",
+			Usage:       "print the result as a JSON object",
+			DefaultText: "false",
+			Value:       false,
+		},
+	}, dhtRequestFlags...),
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	vole "github.com/ipfs-shipyard/vole/lib"
+	"github.com/urfave/cli/v2"
+
+	dhtpb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multihash"
+)
+
+var dhtServeCmd = &cli.Command{
+	Name:  "serve",
+	Usage: "run a temporary DHT server node",
+	Description: `creates a libp2p peer running a DHT in server mode and logs every request it receives and response it sends until interrupted.
+Requests are logged with "<-" and responses with "->". The peer listens on the addresses given with the global --listen-addr.`,
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 0 {
+			return fmt.Errorf("invalid number of arguments")
+		}
+
+		var bootstrapPeers []peer.AddrInfo
+		for _, s := range c.StringSlice("bootstrap") {
+			ai, err := peer.AddrInfoFromString(s)
+			if err != nil {
+				return err
+			}
+			bootstrapPeers = append(bootstrapPeers, *ai)
+		}
+
+		ctx, cancel := signal.NotifyContext(c.Context, os.Interrupt)
+		defer cancel()
+
+		s, err := vole.NewDhtServer(ctx, vole.DhtServerConfig{
+			Protocol:       protocol.ID(c.String("protocolID")),
+			BootstrapPeers: bootstrapPeers,
+			DatastorePath:  c.String("datastore"),
+			OnMessage:      printDhtServerMessage,
+		})
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+
+		ai := s.AddrInfo()
+		addrs, err := peer.AddrInfoToP2pAddrs(&ai)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("PeerID: %s\n", ai.ID)
+		fmt.Println("Listen addresses:")
+		for _, a := range addrs {
+			fmt.Printf("\t- %s\n", a)
+		}
+
+		<-ctx.Done()
+		return nil
+	},
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "protocolID",
+			Usage:       "the protocol ID",
+			DefaultText: "/ipfs/kad/1.0.0",
+			Value:       "/ipfs/kad/1.0.0",
+		},
+		&cli.StringSliceFlag{
+			Name:    "bootstrap",
+			Aliases: []string{"B"},
+			Usage:   "multiaddr of a peer to bootstrap the routing table from, may be repeated",
+		},
+		&cli.StringFlag{
+			Name:        "datastore",
+			Usage:       "directory of an on-disk leveldb datastore for the records, kept between runs",
+			DefaultText: "an in-memory datastore",
+		},
+	},
+}
+
+func printDhtServerMessage(m vole.DhtServerMessage) {
+	msg := m.Message
+	ts := m.Time.UTC().Format(time.RFC3339Nano)
+	if m.Inbound {
+		line := fmt.Sprintf("%s <- %s %s", ts, m.Peer, msg.GetType())
+		if k := formatDhtMessageKey(msg); k != "" {
+			line += " " + k
+		}
+		fmt.Println(line)
+		return
+	}
+
+	fmt.Printf("%s -> %s %s record=%s closer=%d providers=%d\n", ts, m.Peer, msg.GetType(),
+		strconv.FormatBool(msg.GetRecord() != nil), len(msg.GetCloserPeers()), len(msg.GetProviderPeers()))
+}
+
+// formatDhtMessageKey renders the key of a DHT message in the form it was most likely derived from
+func formatDhtMessageKey(msg *dhtpb.Message) string {
+	key := msg.GetKey()
+	switch msg.GetType() {
+	case dhtpb.Message_PING:
+		return ""
+	case dhtpb.Message_FIND_NODE:
+		if p, err := peer.IDFromBytes(key); err == nil {
+			return "peer=" + p.String()
+		}
+	case dhtpb.Message_GET_PROVIDERS, dhtpb.Message_ADD_PROVIDER:
+		if mh, err := multihash.Cast(key); err == nil {
+			return "multihash=" + mh.B58String()
+		}
+	default:
+		for _, prefix := range []string{"/ipns/", "/pk/"} {
+			if rest, ok := bytes.CutPrefix(key, []byte(prefix)); ok {
+				if p, err := peer.IDFromBytes(rest); err == nil {
+					return "key=" + prefix + p.String()
+				}
+			}
+		}
+	}
+
+	if utf8.Valid(key) {
+		return "key=" + strconv.Quote(string(key))
+	}
+	enc, _ := multibase.Encode(multibase.Base32, key)
+	return "key=" + enc
+}
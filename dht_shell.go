@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	vole "github.com/ipfs-shipyard/vole/lib"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multibase"
+)
+
+const dhtShellHelp = `commands:
+	put <multibase-bytes-key> <multibase-bytes-value>
+	get <multibase-bytes-key>
+	getprovs <cid>
+	gcp <multibase-bytes-key>
+	ping
+	help
+	exit`
+
+var dhtShellCmd = &cli.Command{
+	Name:      "shell",
+	ArgsUsage: "<multiaddr>",
+	Usage:     "send many DHT requests to a node over a single connection",
+	Description: `creates a libp2p peer, connects to the target and then reads DHT commands from stdin, one per line.
+Commands can be typed interactively or piped in from a script, run "help" in the shell for the list of commands.`,
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return fmt.Errorf("invalid number of arguments")
+		}
+		maStr := c.Args().First()
+		protoID := c.String("protocolID")
+
+		enc, err := multibase.EncoderByName(c.String("base"))
+		if err != nil {
+			return err
+		}
+
+		ma, err := multiaddr.NewMultiaddr(maStr)
+		if err != nil {
+			return err
+		}
+
+		ai, err := peer.AddrInfoFromP2pAddr(ma)
+		if err != nil {
+			return err
+		}
+
+		client, err := vole.NewDhtClient(c.Context, protocol.ID(protoID), ai, dhtOptions(c)...)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		sh := &dhtShell{
+			client:    client,
+			enc:       enc,
+			showAddrs: c.Bool("show-addrs"),
+			distance:  c.Bool("distance"),
+		}
+		return sh.run(c.Context, os.Stdin, isTerminal(os.Stdin))
+	},
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:        "protocolID",
+			Usage:       "the protocol ID",
+			DefaultText: "/ipfs/kad/1.0.0",
+			Value:       "/ipfs/kad/1.0.0",
+		},
+		&cli.StringFlag{
+			Name:        "base",
+			Aliases:     []string{"b"},
+			Usage:       "multibase to encode record values in (e.g. b or base32 for base32 encoding)",
+			DefaultText: "base32",
+			Value:       "base32",
+		},
+		&cli.BoolFlag{
+			Name:        "show-addrs",
+			Aliases:     []string{"a"},
+			Usage:       "show the peer address or just the IDs",
+			DefaultText: "false",
+			Value:       false,
+		},
+		distanceFlag,
+	}, dhtRequestFlags...),
+}
+
+type dhtShell struct {
+	client    *vole.DhtClient
+	enc       multibase.Encoder
+	showAddrs bool
+	distance  bool
+}
+
+// target returns the key to annotate peers with their distance to, or nil if distances are not shown
+func (sh *dhtShell) target(key []byte) []byte {
+	if !sh.distance {
+		return nil
+	}
+	return key
+}
+
+// run executes commands read from in until it is exhausted or an exit command is read.
+// When running non-interactively an error is returned if any of the commands failed.
+func (sh *dhtShell) run(ctx context.Context, in io.Reader, interactive bool) error {
+	failed := 0
+	scanner := bufio.NewScanner(in)
+	for {
+		if interactive {
+			fmt.Fprint(os.Stderr, "> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" {
+			break
+		}
+
+		if err := sh.exec(ctx, args[0], args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", args[0], err)
+			failed++
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if failed > 0 && !interactive {
+		return fmt.Errorf("%d commands failed", failed)
+	}
+	return nil
+}
+
+func (sh *dhtShell) exec(ctx context.Context, cmd string, args []string) error {
+	switch cmd {
+	case "put":
+		if len(args) != 2 {
+			return fmt.Errorf("invalid number of arguments")
+		}
+		_, keyBytes, err := multibase.Decode(args[0])
+		if err != nil {
+			return err
+		}
+		_, valBytes, err := multibase.Decode(args[1])
+		if err != nil {
+			return err
+		}
+		if err := sh.client.Put(ctx, keyBytes, valBytes); err != nil {
+			return err
+		}
+		fmt.Println("Ok")
+	case "get":
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments")
+		}
+		_, keyBytes, err := multibase.Decode(args[0])
+		if err != nil {
+			return err
+		}
+		rec, err := sh.client.Get(ctx, keyBytes)
+		if err != nil {
+			return err
+		}
+		fmt.Println(sh.enc.Encode(rec.GetValue()))
+	case "getprovs":
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments")
+		}
+		dataCID, err := cid.Decode(args[0])
+		if err != nil {
+			return err
+		}
+		provs, err := sh.client.GetProvs(ctx, dataCID.Hash())
+		if err != nil {
+			return err
+		}
+		return printPeerIDs(provs, sh.showAddrs, sh.target(dataCID.Hash()))
+	case "gcp":
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments")
+		}
+		_, keyBytes, err := multibase.Decode(args[0])
+		if err != nil {
+			return err
+		}
+		ais, err := sh.client.GetClosestPeers(ctx, keyBytes)
+		if err != nil {
+			return err
+		}
+		return printPeerIDs(ais, sh.showAddrs, sh.target(keyBytes))
+	case "ping":
+		if len(args) != 0 {
+			return fmt.Errorf("invalid number of arguments")
+		}
+		if err := sh.client.Ping(ctx); err != nil {
+			return err
+		}
+		fmt.Println("Ok")
+	case "help":
+		fmt.Println(dhtShellHelp)
+	default:
+		return fmt.Errorf("unknown command, run \"help\" for the list of commands")
+	}
+	return nil
+}
+
+// isTerminal reports whether f is attached to a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
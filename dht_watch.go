@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	vole "github.com/ipfs-shipyard/vole/lib"
+	"github.com/urfave/cli/v2"
+)
+
+var dhtWatchCmd = &cli.Command{
+	Name:      "watch",
+	ArgsUsage: "[<multibase-bytes-key>] [<multiaddr>]",
+	Usage:     "watch a record or provider set propagate across DHT nodes",
+	Description: `creates a libp2p peer, looks up the K closest peers to the key starting from the target and queries them for the record (or providers with --providers) every interval.
+Prints a timestamped line whenever a node gains the record, holds a different version of it or loses it, and the number of holders whenever it changes.
+Nodes that fail to answer in a round keep their last known state.
+Exits once --min-holders nodes hold the record, or when interrupted.`,
+	Action: func(c *cli.Context) error {
+		interval := c.Duration("interval")
+		if interval <= 0 {
+			return fmt.Errorf("interval must be positive")
+		}
+		minHolders := c.Int("min-holders")
+
+		client, kind, key, nodes, err := dhtCheckSetup(c)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if minHolders > len(nodes) {
+			return fmt.Errorf("cannot wait for %d holders when watching %d nodes", minHolders, len(nodes))
+		}
+
+		ctx, cancel := signal.NotifyContext(c.Context, os.Interrupt)
+		defer cancel()
+
+		start := time.Now()
+		fmt.Printf("%s watching %d nodes every %s\n", start.UTC().Format(time.RFC3339), len(nodes), interval)
+		lastHolders := -1
+		err = client.WatchNodes(ctx, kind, key, nodes, interval, func(r vole.DhtWatchRound) bool {
+			prefix := fmt.Sprintf("%s +%s", r.Time.UTC().Format(time.RFC3339), r.Time.Sub(start).Round(time.Millisecond))
+			for _, ch := range r.Changes {
+				fmt.Printf("%s %s %s%s\n", prefix, ch.Peer, ch.Kind, formatDhtNodeHoldings(kind, ch.Current))
+			}
+			if r.Holders != lastHolders {
+				fmt.Printf("%s %d of %d nodes hold the %s\n", prefix, r.Holders, len(nodes), dhtWatchSubject(kind))
+				lastHolders = r.Holders
+			}
+			return minHolders > 0 && r.Holders >= minHolders
+		})
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	},
+	Flags: append([]cli.Flag{
+		&cli.DurationFlag{
+			Name:        "interval",
+			Usage:       "how long to wait between rounds of queries",
+			DefaultText: "10s",
+			Value:       time.Second * 10,
+		},
+		&cli.IntFlag{
+			Name:        "min-holders",
+			Usage:       "exit once this many nodes hold the record or providers, 0 to watch until interrupted",
+			DefaultText: "0",
+			Value:       0,
+		},
+	}, dhtCheckFlags...),
+}
+
+func dhtWatchSubject(kind vole.DhtQueryKind) string {
+	if kind == vole.DhtQueryProviders {
+		return "provider records"
+	}
+	return "record"
+}
+
+// formatDhtNodeHoldings describes what a node holds after a change, a node that lost the record holds nothing
+func formatDhtNodeHoldings(kind vole.DhtQueryKind, r *vole.DhtNodeResult) string {
+	if !r.Holds() {
+		return ""
+	}
+	if kind == vole.DhtQueryProviders {
+		return fmt.Sprintf(" providers=%d", len(r.Providers))
+	}
+	s := " value=" + r.ValueDigest
+	if r.Sequence != nil {
+		s = fmt.Sprintf(" seq=%d%s", *r.Sequence, s)
+	}
+	return s
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	vole "github.com/ipfs-shipyard/vole/lib"
+	"github.com/urfave/cli/v2"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// hostFlags are the global flags configuring the libp2p peer vole runs commands from
+var hostFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:        "identity",
+		Usage:       "file holding the private key of vole's libp2p peer, a new key is saved there if it does not exist",
+		DefaultText: "a random identity for every run",
+	},
+	&cli.StringSliceFlag{
+		Name:        "listen-addr",
+		Usage:       "multiaddr for vole's libp2p peer to listen on, may be repeated",
+		DefaultText: "the libp2p default listen addresses",
+	},
+	&cli.StringSliceFlag{
+		Name:        "transport",
+		Usage:       "transport to enable, one of tcp, quic, webtransport, websocket and webrtc-direct, may be repeated",
+		DefaultText: "all of them",
+	},
+	&cli.StringSliceFlag{
+		Name:        "security",
+		Usage:       "security protocol to enable, tls or noise, may be repeated in order of preference",
+		DefaultText: "tls then noise",
+	},
+	&cli.StringSliceFlag{
+		Name:        "muxer",
+		Usage:       "stream multiplexer to enable, may be repeated in order of preference",
+		DefaultText: "yamux",
+	},
+	&cli.StringFlag{
+		Name:        "user-agent",
+		Usage:       "agent version vole's libp2p peer announces",
+		DefaultText: "the version of vole",
+	},
+	&cli.StringFlag{
+		Name:        "swarm-key",
+		Usage:       "swarm.key file of the private network to join, which limits the transports to tcp and websocket",
+		DefaultText: "the public network",
+	},
+	&cli.StringSliceFlag{
+		Name:        "relay",
+		Usage:       "multiaddr with the peer ID of a circuit relay to make a reservation on, so vole can be reached through it, may be repeated",
+		DefaultText: "no relay",
+	},
+}
+
+// configureHost sets up the libp2p peer of every command from the global flags
+func configureHost(c *cli.Context) error {
+	cfg := vole.HostConfig{
+		IdentityFile: c.String("identity"),
+		Transports:   c.StringSlice("transport"),
+		Security:     c.StringSlice("security"),
+		Muxers:       c.StringSlice("muxer"),
+		UserAgent:    c.String("user-agent"),
+	}
+	if path := c.String("swarm-key"); path != "" {
+		psk, err := vole.LoadSwarmKey(path)
+		if err != nil {
+			return err
+		}
+		cfg.PSK = psk
+	}
+	for _, s := range c.StringSlice("listen-addr") {
+		ma, err := multiaddr.NewMultiaddr(s)
+		if err != nil {
+			return err
+		}
+		cfg.ListenAddrs = append(cfg.ListenAddrs, ma)
+	}
+	if relays := c.StringSlice("relay"); len(relays) > 0 {
+		var addrs []multiaddr.Multiaddr
+		for _, s := range relays {
+			ma, err := multiaddr.NewMultiaddr(s)
+			if err != nil {
+				return err
+			}
+			addrs = append(addrs, ma)
+		}
+		ais, err := peer.AddrInfosFromP2pAddrs(addrs...)
+		if err != nil {
+			return err
+		}
+		cfg.Relays = ais
+		cfg.OnReservation = printRelayReservation
+	}
+	return vole.SetHostConfig(cfg)
+}
+
+// printRelayReservation reports relay reservations on stderr, which keeps the output of the commands intact
+func printRelayReservation(r *vole.RelayReservation) {
+	if r.Error != nil {
+		fmt.Fprintf(os.Stderr, "relay %s: reservation failed: %v\n", r.Relay, r.Error)
+		return
+	}
+	verb := "reserved"
+	if r.Renewal {
+		verb = "renewed"
+	}
+	fmt.Fprintf(os.Stderr, "relay %s: %s until %s, reachable at:\n", r.Relay, verb, r.Expiration.Format(time.RFC3339))
+	for _, a := range r.Addrs {
+		fmt.Fprintf(os.Stderr, "\t%s\n", a)
+	}
+}
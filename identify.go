@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	vole "github.com/ipfs-shipyard/vole/lib"
+	"github.com/urfave/cli/v2"
+
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// identifyMany identifies every multiaddr given as an argument or in the --file, printing one JSON result per line
+func identifyMany(c *cli.Context, allowUnknownPeer bool) error {
+	maStrs := c.Args().Slice()
+	if f := c.String("file"); f != "" {
+		fromFile, err := readAddrList(f)
+		if err != nil {
+			return err
+		}
+		maStrs = append(maStrs, fromFile...)
+	}
+	if len(maStrs) == 0 {
+		return fmt.Errorf("invalid number of arguments")
+	}
+	if c.Int("concurrency") < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+	if c.Duration("timeout") <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	var encErr error
+	err := vole.IdentifyRequests(c.Context, maStrs, allowUnknownPeer, c.Int("concurrency"), c.Duration("timeout"), func(r *vole.IdentifyResult) {
+		if err := enc.Encode(r); err != nil && encErr == nil {
+			encErr = err
+		}
+	}, identifyOptions(c)...)
+	if err != nil {
+		return err
+	}
+	return encErr
+}
+
+// readAddrList reads one multiaddr per line from the file, or stdin if the name is -, skipping blank lines and # comments
+func readAddrList(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var addrs []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addrs = append(addrs, line)
+	}
+	return addrs, scanner.Err()
+}
+
+// watchIdentify prints the changes to what the peer advertises over identify until interrupted
+func watchIdentify(c *cli.Context, allowUnknownPeer bool) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("invalid number of arguments")
+	}
+	if c.Duration("reconnect-interval") <= 0 {
+		return fmt.Errorf("reconnect interval must be positive")
+	}
+
+	ctx, cancel := signal.NotifyContext(c.Context, os.Interrupt)
+	defer cancel()
+
+	enc := json.NewEncoder(os.Stdout)
+	asJSON := c.Bool("json")
+	err := vole.WatchIdentify(ctx, c.Args().First(), allowUnknownPeer, c.Duration("reconnect-interval"), func(u *vole.IdentifyUpdate) {
+		if asJSON {
+			_ = enc.Encode(u)
+			return
+		}
+		printIdentifyUpdate(u)
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+func printIdentifyUpdate(u *vole.IdentifyUpdate) {
+	fmt.Printf("%s %s %s\n", u.Time.UTC().Format(time.RFC3339), u.Peer, u.Kind)
+	if u.AgentVersion != nil {
+		fmt.Printf("\tagent version: %q\n", *u.AgentVersion)
+	}
+	if u.ProtocolVersion != nil {
+		fmt.Printf("\tprotocol version: %q\n", *u.ProtocolVersion)
+	}
+	for _, a := range u.ListenAddrsAdded {
+		fmt.Printf("\t+ address %q\n", a)
+	}
+	for _, a := range u.ListenAddrsRemoved {
+		fmt.Printf("\t- address %q\n", a)
+	}
+	for _, p := range u.ProtocolsAdded {
+		fmt.Printf("\t+ protocol %q\n", p)
+	}
+	for _, p := range u.ProtocolsRemoved {
+		fmt.Printf("\t- protocol %q\n", p)
+	}
+}
+
+func identifyOptions(c *cli.Context) []vole.IdentifyOption {
+	if !c.Bool("probe") {
+		return nil
+	}
+	extra := vole.WellKnownProtocols
+	if c.IsSet("probe-protocol") {
+		extra = nil
+		for _, p := range c.StringSlice("probe-protocol") {
+			extra = append(extra, protocol.ID(p))
+		}
+	}
+	return []vole.IdentifyOption{vole.IdentifyProbeProtocols(extra...)}
+}
+
+func printProtocolProbes(probes []*vole.ProtocolProbe) {
+	fmt.Println("Protocol probes:")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, pr := range probes {
+		status := string(pr.Status)
+		if pr.Error != nil {
+			status += ": " + oneLineErr(pr.Error)
+		}
+		fmt.Fprintf(tw, "\t- %q\t%s\n", pr.Protocol, status)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,79 @@
+package vole
+
+import (
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// AddrScope describes where an address can be reached from
+type AddrScope string
+
+const (
+	AddrScopePublic   AddrScope = "public"
+	AddrScopePrivate  AddrScope = "private"
+	AddrScopeLoopback AddrScope = "loopback"
+	AddrScopeRelay    AddrScope = "relay"
+	// AddrScopeUnknown is used for addresses that are neither IP nor DNS based
+	AddrScopeUnknown AddrScope = "unknown"
+)
+
+// ClassifyAddrScope returns the scope of an address, relayed addresses are classified as relay regardless of the relay's own address
+func ClassifyAddrScope(a multiaddr.Multiaddr) AddrScope {
+	if _, err := a.ValueForProtocol(multiaddr.P_CIRCUIT); err == nil {
+		return AddrScopeRelay
+	}
+	switch {
+	case manet.IsIPLoopback(a):
+		return AddrScopeLoopback
+	case manet.IsPrivateAddr(a):
+		return AddrScopePrivate
+	case manet.IsPublicAddr(a):
+		return AddrScopePublic
+	default:
+		return AddrScopeUnknown
+	}
+}
+
+// ClassifiedAddr is an address along with where it can be reached from and the transport it uses
+type ClassifiedAddr struct {
+	Addr      multiaddr.Multiaddr
+	Scope     AddrScope
+	Transport string
+}
+
+// ClassifyAddr returns the scope and transport of an address
+func ClassifyAddr(a multiaddr.Multiaddr) ClassifiedAddr {
+	return ClassifiedAddr{Addr: a, Scope: ClassifyAddrScope(a), Transport: AddrTransport(a)}
+}
+
+// ClassifyAddrs classifies each of the addresses
+func ClassifyAddrs(addrs []multiaddr.Multiaddr) []ClassifiedAddr {
+	res := make([]ClassifiedAddr, 0, len(addrs))
+	for _, a := range addrs {
+		res = append(res, ClassifyAddr(a))
+	}
+	return res
+}
+
+// AddrTransport returns the name of the outermost transport of an address, e.g. tcp, quic-v1, ws, wss, webtransport or p2p-circuit.
+// An empty string is returned for addresses without a known transport.
+func AddrTransport(a multiaddr.Multiaddr) string {
+	transport := ""
+	secure := false
+	for _, c := range a {
+		switch c.Protocol().Code {
+		case multiaddr.P_TCP, multiaddr.P_UDP, multiaddr.P_QUIC, multiaddr.P_QUIC_V1, multiaddr.P_WEBTRANSPORT,
+			multiaddr.P_WEBRTC_DIRECT, multiaddr.P_WEBRTC, multiaddr.P_WSS, multiaddr.P_CIRCUIT, multiaddr.P_UNIX:
+			transport = c.Protocol().Name
+		case multiaddr.P_TLS:
+			secure = true
+		case multiaddr.P_WS:
+			// /tls/ws is the newer way of writing /wss
+			transport = "ws"
+			if secure {
+				transport = "wss"
+			}
+		}
+	}
+	return transport
+}
@@ -0,0 +1,29 @@
+package vole
+
+import (
+	"testing"
+
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestClassifyAddr(t *testing.T) {
+	for _, tc := range []struct {
+		addr      string
+		scope     AddrScope
+		transport string
+	}{
+		{"/ip4/1.2.3.4/tcp/4001", AddrScopePublic, "tcp"},
+		{"/ip4/192.168.1.2/udp/4001/quic-v1", AddrScopePrivate, "quic-v1"},
+		{"/ip4/127.0.0.1/udp/4001/quic-v1/webtransport", AddrScopeLoopback, "webtransport"},
+		{"/ip6/2001:4860::1/udp/4001/webrtc-direct", AddrScopePublic, "webrtc-direct"},
+		{"/dns4/example.com/tcp/443/wss", AddrScopePublic, "wss"},
+		{"/dns4/example.com/tcp/443/tls/sni/example.com/ws", AddrScopePublic, "wss"},
+		{"/ip4/1.2.3.4/tcp/80/ws", AddrScopePublic, "ws"},
+		{"/ip4/1.2.3.4/tcp/4001/p2p/12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN/p2p-circuit", AddrScopeRelay, "p2p-circuit"},
+	} {
+		c := ClassifyAddr(multiaddr.StringCast(tc.addr))
+		if c.Scope != tc.scope || c.Transport != tc.transport {
+			t.Fatalf("%s: expected (%s, %s), got (%s, %s)", tc.addr, tc.scope, tc.transport, c.Scope, c.Transport)
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 	format "github.com/ipfs/go-ipld-format"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/multiformats/go-multiaddr"
 
 	"github.com/ipfs/boxo/bitswap"
@@ -30,6 +31,8 @@ import (
 	rhelp "github.com/libp2p/go-libp2p-routing-helpers"
 )
 
+var bitswapProtocols = []protocol.ID{"/ipfs/bitswap/1.2.0", "/ipfs/bitswap/1.1.0", "/ipfs/bitswap/1.0.0", "/ipfs/bitswap"}
+
 type BsCheckOutput struct {
 	Found     bool
 	Responded bool
@@ -80,7 +83,7 @@ func CheckBitswapCID(ctx context.Context, h host.Host, c cid.Cid, ma multiaddr.M
 	tctx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 	// Create a new stream to ensure we wait for hole punching even if it takes longer than the built-in limit in the Bitswap implementation
-	_, err = h.NewStream(tctx, ai.ID, "/ipfs/bitswap/1.2.0", "/ipfs/bitswap/1.1.0", "/ipfs/bitswap/1.0.0", "/ipfs/bitswap")
+	_, err = h.NewStream(tctx, ai.ID, bitswapProtocols...)
 	if err != nil {
 		return nil, err
 	}
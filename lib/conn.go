@@ -0,0 +1,87 @@
+package vole
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// ConnInfo describes a connection to a peer
+type ConnInfo struct {
+	LocalAddr  multiaddr.Multiaddr
+	RemoteAddr multiaddr.Multiaddr
+	Transport  string
+	// Security and Muxer are empty for transports that secure and multiplex the connection themselves, such as QUIC
+	Security protocol.ID
+	Muxer    protocol.ID
+	// Limited is set for connections the remote end restricts in duration or data, in practice relayed connections
+	Limited bool
+	Relayed bool
+	// Direction is Outbound when we dialed the connection and Inbound when the peer did
+	Direction string
+	Opened    time.Time
+	// HolePunched is set for direct connections to a peer we could only reach through relays
+	HolePunched bool
+}
+
+// NewConnInfo describes the connection, dialedAddrs are the addresses that were given to reach the peer
+func NewConnInfo(c network.Conn, dialedAddrs []multiaddr.Multiaddr) *ConnInfo {
+	state := c.ConnState()
+	stat := c.Stat()
+	info := &ConnInfo{
+		LocalAddr:  c.LocalMultiaddr(),
+		RemoteAddr: c.RemoteMultiaddr(),
+		Transport:  AddrTransport(c.RemoteMultiaddr()),
+		Security:   state.Security,
+		Muxer:      state.StreamMultiplexer,
+		Limited:    stat.Limited,
+		Relayed:    isRelayedAddr(c.RemoteMultiaddr()),
+		Direction:  stat.Direction.String(),
+		Opened:     stat.Opened,
+	}
+	if info.Transport == "" {
+		info.Transport = state.Transport
+	}
+	if !info.Relayed && len(dialedAddrs) > 0 {
+		info.HolePunched = true
+		for _, a := range dialedAddrs {
+			if !isRelayedAddr(a) {
+				info.HolePunched = false
+				break
+			}
+		}
+	}
+	return info
+}
+
+// Print writes the connection details, one per line
+func (c *ConnInfo) Print() {
+	orBuiltIn := func(p protocol.ID) string {
+		switch {
+		case p != "":
+			return string(p)
+		case c.Relayed:
+			return "not reported for relayed connections"
+		default:
+			return "built into the transport"
+		}
+	}
+	fmt.Println("Connection:")
+	fmt.Printf("\tLocal address: %s\n", c.LocalAddr)
+	fmt.Printf("\tRemote address: %s\n", c.RemoteAddr)
+	fmt.Printf("\tTransport: %s\n", c.Transport)
+	fmt.Printf("\tSecurity: %s\n", orBuiltIn(c.Security))
+	fmt.Printf("\tMuxer: %s\n", orBuiltIn(c.Muxer))
+	fmt.Printf("\tDirection: %s\n", c.Direction)
+	fmt.Printf("\tRelayed: %t\n", c.Relayed)
+	fmt.Printf("\tLimited: %t\n", c.Limited)
+	fmt.Printf("\tHole punched: %t\n", c.HolePunched)
+}
+
+func isRelayedAddr(a multiaddr.Multiaddr) bool {
+	_, err := a.ValueForProtocol(multiaddr.P_CIRCUIT)
+	return err == nil
+}
@@ -0,0 +1,48 @@
+package vole
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestNewConnInfo(t *testing.T) {
+	h1, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h1.Close()
+	h2, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+
+	if err := h2.Connect(context.Background(), peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	conns := h2.Network().ConnsToPeer(h1.ID())
+	if len(conns) != 1 {
+		t.Fatalf("expected 1 connection, got %d", len(conns))
+	}
+
+	info := NewConnInfo(conns[0], h1.Addrs())
+	if !info.RemoteAddr.Equal(h1.Addrs()[0]) || info.Transport != "tcp" {
+		t.Fatalf("expected a tcp connection to %s, got %+v", h1.Addrs()[0], info)
+	}
+	if info.Security == "" || info.Muxer == "" {
+		t.Fatalf("expected the security protocol and muxer of a tcp connection to be known, got %+v", info)
+	}
+	if info.Direction != network.DirOutbound.String() || info.Relayed || info.Limited || info.HolePunched {
+		t.Fatalf("expected a direct outbound connection, got %+v", info)
+	}
+
+	relayAddr := multiaddr.StringCast("/ip4/127.0.0.1/tcp/4001/p2p/12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN/p2p-circuit")
+	if info := NewConnInfo(conns[0], []multiaddr.Multiaddr{relayAddr}); !info.HolePunched {
+		t.Fatal("expected a direct connection to a peer dialed through a relay to count as hole punched")
+	}
+}
@@ -0,0 +1,266 @@
+package vole
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/sec"
+	"github.com/libp2p/go-libp2p/p2p/net/pnet"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
+	"github.com/libp2p/go-libp2p/p2p/security/noise"
+	tls "github.com/libp2p/go-libp2p/p2p/security/tls"
+	"github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+	manet "github.com/multiformats/go-multiaddr/net"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+// ConnectPhases is how long each phase of setting up a connection to one address of a peer took
+type ConnectPhases struct {
+	// Addr is the address of the peer and DialedAddr the address it resolved to
+	Addr       multiaddr.Multiaddr
+	DialedAddr multiaddr.Multiaddr
+	Transport  string
+	// DNS is the time it took to resolve Addr, it is shared by all the addresses it resolved to
+	DNS                time.Duration
+	TransportHandshake time.Duration
+	SecurityHandshake  time.Duration
+	// MuxerNegotiation is the time it took to agree on a muxer and set it up. When EarlyMuxer is set the muxer was agreed on
+	// during the security handshake, as TLS and Noise do when both sides support it, so it only covers setting the muxer up.
+	MuxerNegotiation time.Duration
+	EarlyMuxer       bool
+	// FirstStream is the time it took to open a stream and agree on a protocol for it
+	FirstStream time.Duration
+	// Combined is set when the security handshake and muxer negotiation could not be timed apart from the transport handshake,
+	// which then includes them. This is the case for transports that secure and multiplex connections themselves, such as QUIC.
+	Combined bool
+	Security protocol.ID
+	Muxer    protocol.ID
+	// Total is the time from starting to resolve the address until the first stream was opened, leaving out the time spent setting up vole's side
+	Total time.Duration
+	Error error
+}
+
+func (o *ConnectPhases) MarshalJSON() ([]byte, error) {
+	type connectPhases ConnectPhases
+	var errorMsg *string
+	if o.Error != nil {
+		m := o.Error.Error()
+		errorMsg = &m
+	}
+	anon := struct {
+		*connectPhases
+		DNS                string
+		TransportHandshake string
+		SecurityHandshake  string
+		MuxerNegotiation   string
+		FirstStream        string
+		Total              string
+		Error              *string
+	}{
+		connectPhases:      (*connectPhases)(o),
+		DNS:                o.DNS.String(),
+		TransportHandshake: o.TransportHandshake.String(),
+		SecurityHandshake:  o.SecurityHandshake.String(),
+		MuxerNegotiation:   o.MuxerNegotiation.String(),
+		FirstStream:        o.FirstStream.String(),
+		Total:              o.Total.String(),
+		Error:              errorMsg,
+	}
+	return json.Marshal(anon)
+}
+
+var _ json.Marshaler = (*ConnectPhases)(nil)
+
+// MeasureConnectPhases connects to each address of the peer in turn, giving each at most timeout, and times the phases of the connection setup.
+// TCP connections are set up step by step the way libp2p does it, with the security protocols and muxers of the host configuration,
+// other transports, and TCP when the host configuration leaves it out, are dialed with a new libp2p host.
+// onResult is called for every address that was dialed, or that could not be resolved.
+func MeasureConnectPhases(ctx context.Context, p *peer.AddrInfo, timeout time.Duration, onResult func(*ConnectPhases)) {
+	for _, a := range p.Addrs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		actx, cancel := context.WithTimeout(ctx, timeout)
+		dialed := []multiaddr.Multiaddr{a}
+		var dnsTime time.Duration
+		if madns.Matches(a) {
+			start := time.Now()
+			resolved, err := madns.DefaultResolver.Resolve(actx, a)
+			dnsTime = time.Since(start)
+			if err == nil && len(resolved) == 0 {
+				err = fmt.Errorf("%s did not resolve to any address", a)
+			}
+			if err != nil {
+				onResult(&ConnectPhases{Addr: a, Transport: AddrTransport(a), DNS: dnsTime, Total: dnsTime, Error: err})
+				cancel()
+				continue
+			}
+			dialed = dialed[:0]
+			for _, r := range resolved {
+				// dnsaddr records can point at other peers
+				if tpt, id := peer.SplitAddr(r); id == "" || id == p.ID {
+					dialed = append(dialed, tpt)
+				}
+			}
+		}
+
+		for _, d := range dialed {
+			res := &ConnectPhases{Addr: a, DialedAddr: d, Transport: AddrTransport(d), DNS: dnsTime}
+			if res.Transport == "tcp" && hostConfig.transportEnabled("tcp") {
+				res.Error = measureTCPPhases(actx, p.ID, res)
+			} else {
+				res.Error = measureHostPhases(actx, p.ID, res)
+			}
+			onResult(res)
+		}
+		cancel()
+	}
+}
+
+// measureTCPPhases upgrades a TCP connection to the peer by hand, timing each step
+func measureTCPPhases(ctx context.Context, p peer.ID, res *ConnectPhases) error {
+	key, err := hostConfig.identity()
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		if key, _, err = crypto.GenerateEd25519Key(rand.Reader); err != nil {
+			return err
+		}
+	}
+	secIDs, err := hostConfig.securityIDs()
+	if err != nil {
+		return err
+	}
+	// like libp2p, offer to pick the muxer during the security handshake
+	muxers, err := hostConfig.muxers()
+	if err != nil {
+		return err
+	}
+	tlsTpt, err := tls.New(tls.ID, key, muxers)
+	if err != nil {
+		return err
+	}
+	noiseTpt, err := noise.New(noise.ID, key, muxers)
+	if err != nil {
+		return err
+	}
+	secTpts := map[protocol.ID]sec.SecureTransport{tls.ID: tlsTpt, noise.ID: noiseTpt}
+
+	dialStart := time.Now()
+	defer func() { res.Total = res.DNS + time.Since(dialStart) }()
+	var d manet.Dialer
+	rawConn, err := d.DialContext(ctx, res.DialedAddr)
+	if err != nil {
+		return err
+	}
+	defer rawConn.Close()
+	res.TransportHandshake = time.Since(dialStart)
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = rawConn.SetDeadline(deadline)
+	}
+	var conn net.Conn = rawConn
+	if hostConfig.PSK != nil {
+		// the private network nonces go out with the first message of the security negotiation
+		if conn, err = pnet.NewProtectedConn(hostConfig.PSK, rawConn); err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	secID, err := msmux.SelectOneOf(secIDs, conn)
+	if err != nil {
+		return fmt.Errorf("negotiating the security protocol: %w", err)
+	}
+	sconn, err := secTpts[secID].SecureOutbound(ctx, conn, p)
+	if err != nil {
+		return err
+	}
+	res.SecurityHandshake = time.Since(start)
+	res.Security = secID
+
+	start = time.Now()
+	muxerID := sconn.ConnState().StreamMultiplexer
+	res.EarlyMuxer = muxerID != ""
+	if muxerID == "" {
+		muxerIDs := make([]protocol.ID, 0, len(muxers))
+		for _, m := range muxers {
+			muxerIDs = append(muxerIDs, m.ID)
+		}
+		if muxerID, err = msmux.SelectOneOf(muxerIDs, sconn); err != nil {
+			return fmt.Errorf("negotiating the muxer: %w", err)
+		}
+	}
+	i := slices.IndexFunc(muxers, func(m tptu.StreamMuxer) bool { return m.ID == muxerID })
+	if i < 0 {
+		return fmt.Errorf("the peer picked the muxer %s, which was not offered", muxerID)
+	}
+	mconn, err := muxers[i].Muxer.NewConn(sconn, false, &network.NullScope{})
+	if err != nil {
+		return err
+	}
+	defer mconn.Close()
+	res.MuxerNegotiation = time.Since(start)
+	res.Muxer = muxerID
+
+	start = time.Now()
+	s, err := mconn.OpenStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = s.Reset() }()
+	if err := msmux.SelectProtoOrFail(pingProtocol, s); err != nil {
+		return err
+	}
+	res.FirstStream = time.Since(start)
+	return nil
+}
+
+// measureHostPhases dials the address from a new libp2p host, which only tells how long the whole handshake took
+func measureHostPhases(ctx context.Context, p peer.ID, res *ConnectPhases) error {
+	res.Combined = true
+	tracer := &handshakeTracer{}
+	h, err := newHost(libp2p.DisableMetrics(), libp2p.SwarmOpts(swarm.WithMetricsTracer(tracer)))
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	ctx = network.WithAllowLimitedConn(ctx, "connect")
+	h.Peerstore().AddAddr(p, res.DialedAddr, peerstore.TempAddrTTL)
+	dialStart := time.Now()
+	defer func() { res.Total = res.DNS + time.Since(dialStart) }()
+	conn, err := h.Network().DialPeer(ctx, p)
+	if err != nil {
+		return err
+	}
+	res.TransportHandshake = tracer.handshake()
+	res.Security = conn.ConnState().Security
+	res.Muxer = conn.ConnState().StreamMultiplexer
+
+	start := time.Now()
+	s, err := conn.NewStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = s.Reset() }()
+	if err := msmux.SelectProtoOrFail(pingProtocol, s); err != nil {
+		return err
+	}
+	res.FirstStream = time.Since(start)
+	return nil
+}
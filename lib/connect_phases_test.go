@@ -0,0 +1,75 @@
+package vole
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestMeasureConnectPhases(t *testing.T) {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0", "/ip4/127.0.0.1/tcp/0/ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	var tcpAddr, wsAddr multiaddr.Multiaddr
+	for _, a := range h.Addrs() {
+		switch AddrTransport(a) {
+		case "tcp":
+			tcpAddr = a
+		case "ws":
+			wsAddr = a
+		}
+	}
+	dnsAddr := multiaddr.StringCast(strings.Replace(tcpAddr.String(), "/ip4/127.0.0.1", "/dns4/localhost", 1))
+
+	results := make(map[string]*ConnectPhases)
+	MeasureConnectPhases(context.Background(), &peer.AddrInfo{ID: h.ID(), Addrs: []multiaddr.Multiaddr{tcpAddr, wsAddr, dnsAddr}}, time.Second*10, func(r *ConnectPhases) {
+		results[r.Addr.String()] = r
+	})
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.Error != nil {
+			t.Fatalf("%s: %v", r.Addr, r.Error)
+		}
+		if r.TransportHandshake <= 0 || r.FirstStream <= 0 || r.Total < r.TransportHandshake+r.FirstStream {
+			t.Fatalf("%s: expected the phases to have been timed, got %+v", r.Addr, r)
+		}
+		if r.Security == "" || r.Muxer == "" {
+			t.Fatalf("%s: expected the security protocol and muxer to be known, got %+v", r.Addr, r)
+		}
+	}
+
+	tcp := results[tcpAddr.String()]
+	// both sides are go-libp2p, so the muxer is agreed on in the security handshake
+	if tcp.Combined || !tcp.EarlyMuxer || tcp.SecurityHandshake <= 0 || tcp.MuxerNegotiation <= 0 || tcp.DNS != 0 {
+		t.Fatalf("expected each phase of the tcp connection to be timed, got %+v", tcp)
+	}
+	if ws := results[wsAddr.String()]; !ws.Combined {
+		t.Fatalf("expected the websocket handshake to be timed as a whole, got %+v", ws)
+	}
+	if dns := results[dnsAddr.String()]; dns.DNS <= 0 || !dns.DialedAddr.Equal(tcpAddr) {
+		t.Fatalf("expected %s to resolve to %s, got %+v", dnsAddr, tcpAddr, dns)
+	}
+
+	// the phases are measured with vole's host configuration, which may not have the transport
+	defer func() { _ = SetHostConfig(HostConfig{}) }()
+	if err := SetHostConfig(HostConfig{Transports: []string{"websocket"}, Muxers: []string{"yamux"}}); err != nil {
+		t.Fatal(err)
+	}
+	var noTCP *ConnectPhases
+	MeasureConnectPhases(context.Background(), &peer.AddrInfo{ID: h.ID(), Addrs: []multiaddr.Multiaddr{tcpAddr}}, time.Second*10, func(r *ConnectPhases) {
+		noTCP = r
+	})
+	if noTCP == nil || noTCP.Error == nil {
+		t.Fatalf("expected dialing tcp without the tcp transport to fail, got %+v", noTCP)
+	}
+}
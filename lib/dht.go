@@ -15,138 +15,244 @@ import (
 	recpb "github.com/libp2p/go-libp2p-record/pb"
 )
 
-func DhtProtocolMessenger(ctx context.Context, proto protocol.ID, ai *peer.AddrInfo) (*dhtpb.ProtocolMessenger, error) {
+// DhtClient sends DHT requests to a single target peer, reusing one libp2p host and connection for every request
+type DhtClient struct {
+	h      host.Host
+	target peer.ID
+	m      *dhtpb.ProtocolMessenger
+}
+
+// DhtOption configures the way a DhtClient sends its requests
+type DhtOption func(*dhtConfig)
+
+type dhtConfig struct {
+	requestTimeout    time.Duration
+	streamOpenTimeout time.Duration
+	retries           int
+	backoff           time.Duration
+	onAttempt         func(DhtAttempt)
+}
+
+// DhtRequestTimeout sets how long to wait for the response to a request once it has been sent, defaults to 5 seconds.
+// A non-positive d keeps the default.
+func DhtRequestTimeout(d time.Duration) DhtOption {
+	return func(cfg *dhtConfig) {
+		if d > 0 {
+			cfg.requestTimeout = d
+		}
+	}
+}
+
+// DhtStreamOpenTimeout sets how long to wait for a stream to the peer to be opened, by default only the request context applies
+func DhtStreamOpenTimeout(d time.Duration) DhtOption {
+	return func(cfg *dhtConfig) {
+		cfg.streamOpenTimeout = d
+	}
+}
+
+// DhtRetries retries failed requests up to n times on a fresh stream, a negative n is treated as 0.
+// The wait between attempts starts at backoff and doubles after every attempt.
+func DhtRetries(n int, backoff time.Duration) DhtOption {
+	return func(cfg *dhtConfig) {
+		cfg.retries = max(n, 0)
+		cfg.backoff = backoff
+	}
+}
+
+// DhtAttemptReporter registers a function that is called after every attempt at sending a request
+func DhtAttemptReporter(f func(DhtAttempt)) DhtOption {
+	return func(cfg *dhtConfig) {
+		cfg.onAttempt = f
+	}
+}
+
+// DhtAttempt describes a single attempt at sending a DHT request
+type DhtAttempt struct {
+	Peer        peer.ID
+	Type        dhtpb.Message_MessageType
+	Attempt     int
+	MaxAttempts int
+	Duration    time.Duration
+	Err         error
+}
+
+// NewDhtClient creates a libp2p host, connects it to the target peer and returns a client for issuing DHT requests to it.
+// The client must be closed to release the host.
+func NewDhtClient(ctx context.Context, proto protocol.ID, ai *peer.AddrInfo, opts ...DhtOption) (*DhtClient, error) {
+	cfg := dhtConfig{
+		requestTimeout: time.Second * 5,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
 	h, err := libp2pHost()
 	if err != nil {
 		return nil, err
 	}
 
 	if err := h.Connect(ctx, *ai); err != nil {
+		_ = h.Close()
 		return nil, err
 	}
 
 	ms := &dhtMsgSender{
 		h:         h,
 		protocols: []protocol.ID{proto},
-		timeout:   time.Second * 5,
+		cfg:       cfg,
 	}
 	messenger, err := dhtpb.NewProtocolMessenger(ms)
 	if err != nil {
+		_ = h.Close()
 		return nil, err
 	}
 
-	return messenger, nil
+	return &DhtClient{
+		h:      h,
+		target: ai.ID,
+		m:      messenger,
+	}, nil
 }
 
-func DhtPut(ctx context.Context, key, value []byte, proto protocol.ID, ma multiaddr.Multiaddr) error {
-	ai, err := peer.AddrInfoFromP2pAddr(ma)
-	if err != nil {
-		return err
-	}
+// Target returns the peer the client sends its requests to
+func (c *DhtClient) Target() peer.ID {
+	return c.target
+}
 
-	m, err := DhtProtocolMessenger(ctx, proto, ai)
-	if err != nil {
-		return err
-	}
+// Close shuts down the client's libp2p host
+func (c *DhtClient) Close() error {
+	return c.h.Close()
+}
 
-	return m.PutValue(ctx, ai.ID, &recpb.Record{Key: key, Value: value})
+func (c *DhtClient) Put(ctx context.Context, key, value []byte) error {
+	return c.m.PutValue(ctx, c.target, &recpb.Record{Key: key, Value: value})
 }
 
-func DhtGet(ctx context.Context, key []byte, proto protocol.ID, ma multiaddr.Multiaddr) (*recpb.Record, error) {
-	ai, err := peer.AddrInfoFromP2pAddr(ma)
+func (c *DhtClient) Get(ctx context.Context, key []byte) (*recpb.Record, error) {
+	rec, _, err := c.m.GetValue(ctx, c.target, string(key))
 	if err != nil {
 		return nil, err
 	}
+	return rec, nil
+}
 
-	m, err := DhtProtocolMessenger(ctx, proto, ai)
+func (c *DhtClient) GetProvs(ctx context.Context, key []byte) ([]*peer.AddrInfo, error) {
+	provs, _, err := c.m.GetProviders(ctx, c.target, key)
 	if err != nil {
 		return nil, err
 	}
+	return provs, nil
+}
 
-	rec, _, err := m.GetValue(ctx, ai.ID, string(key))
+func (c *DhtClient) GetClosestPeers(ctx context.Context, key []byte) ([]*peer.AddrInfo, error) {
+	return c.m.GetClosestPeers(ctx, c.target, peer.ID(key))
+}
+
+func (c *DhtClient) Ping(ctx context.Context) error {
+	return c.m.Ping(ctx, c.target)
+}
+
+// DhtProtocolMessenger returns a messenger connected to the given peer.
+//
+// Deprecated: the libp2p host backing the messenger is never closed, use NewDhtClient instead.
+func DhtProtocolMessenger(ctx context.Context, proto protocol.ID, ai *peer.AddrInfo) (*dhtpb.ProtocolMessenger, error) {
+	c, err := NewDhtClient(ctx, proto, ai)
 	if err != nil {
 		return nil, err
 	}
-	return rec, nil
+	return c.m, nil
 }
 
-func DhtGetProvs(ctx context.Context, key []byte, proto protocol.ID, ma multiaddr.Multiaddr) ([]*peer.AddrInfo, error) {
+func dhtClientForMultiaddr(ctx context.Context, proto protocol.ID, ma multiaddr.Multiaddr, opts []DhtOption) (*DhtClient, error) {
 	ai, err := peer.AddrInfoFromP2pAddr(ma)
 	if err != nil {
 		return nil, err
 	}
+	return NewDhtClient(ctx, proto, ai, opts...)
+}
 
-	m, err := DhtProtocolMessenger(ctx, proto, ai)
+func DhtPut(ctx context.Context, key, value []byte, proto protocol.ID, ma multiaddr.Multiaddr, opts ...DhtOption) error {
+	c, err := dhtClientForMultiaddr(ctx, proto, ma, opts)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer c.Close()
 
-	provs, _, err := m.GetProviders(ctx, ai.ID, key)
-	if err != nil {
-		return nil, err
-	}
-	return provs, nil
+	return c.Put(ctx, key, value)
 }
 
-func DhtGetClosestPeers(ctx context.Context, key []byte, proto protocol.ID, ma multiaddr.Multiaddr) ([]*peer.AddrInfo, error) {
-	ai, err := peer.AddrInfoFromP2pAddr(ma)
+func DhtGet(ctx context.Context, key []byte, proto protocol.ID, ma multiaddr.Multiaddr, opts ...DhtOption) (*recpb.Record, error) {
+	c, err := dhtClientForMultiaddr(ctx, proto, ma, opts)
 	if err != nil {
 		return nil, err
 	}
+	defer c.Close()
 
-	m, err := DhtProtocolMessenger(ctx, proto, ai)
-	if err != nil {
-		return nil, err
-	}
+	return c.Get(ctx, key)
+}
 
-	ais, err := m.GetClosestPeers(ctx, ai.ID, peer.ID(key))
+func DhtGetProvs(ctx context.Context, key []byte, proto protocol.ID, ma multiaddr.Multiaddr, opts ...DhtOption) ([]*peer.AddrInfo, error) {
+	c, err := dhtClientForMultiaddr(ctx, proto, ma, opts)
 	if err != nil {
 		return nil, err
 	}
+	defer c.Close()
 
-	return ais, nil
+	return c.GetProvs(ctx, key)
 }
 
-func DhtPing(ctx context.Context, proto protocol.ID, ma multiaddr.Multiaddr) error {
-	ai, err := peer.AddrInfoFromP2pAddr(ma)
+func DhtGetClosestPeers(ctx context.Context, key []byte, proto protocol.ID, ma multiaddr.Multiaddr, opts ...DhtOption) ([]*peer.AddrInfo, error) {
+	c, err := dhtClientForMultiaddr(ctx, proto, ma, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer c.Close()
 
-	m, err := DhtProtocolMessenger(ctx, proto, ai)
-	if err != nil {
-		return err
-	}
+	return c.GetClosestPeers(ctx, key)
+}
 
-	err = m.Ping(ctx, ai.ID)
+func DhtPing(ctx context.Context, proto protocol.ID, ma multiaddr.Multiaddr, opts ...DhtOption) error {
+	c, err := dhtClientForMultiaddr(ctx, proto, ma, opts)
 	if err != nil {
 		return err
 	}
+	defer c.Close()
 
-	return nil
+	return c.Ping(ctx)
 }
 
 // dhtMsgSender handles sending dht wire protocol messages to a given peer
 type dhtMsgSender struct {
 	h         host.Host
 	protocols []protocol.ID
-	timeout   time.Duration
+	cfg       dhtConfig
 }
 
-// SendRequest sends a peer a message and waits for its response
+// SendRequest sends a peer a message and waits for its response, retrying on a fresh stream if configured to
 func (ms *dhtMsgSender) SendRequest(ctx context.Context, p peer.ID, pmes *dhtpb.Message) (*dhtpb.Message, error) {
-	s, err := ms.h.NewStream(ctx, p, ms.protocols...)
+	var msg *dhtpb.Message
+	err := ms.withRetries(ctx, p, pmes, func() error {
+		var err error
+		msg, err = ms.sendRequest(ctx, p, pmes)
+		return err
+	})
+	return msg, err
+}
+
+func (ms *dhtMsgSender) sendRequest(ctx context.Context, p peer.ID, pmes *dhtpb.Message) (*dhtpb.Message, error) {
+	s, err := ms.newStream(ctx, p)
 	if err != nil {
 		return nil, err
 	}
 
 	w := pbio.NewDelimitedWriter(s)
 	if err := w.WriteMsg(pmes); err != nil {
+		_ = s.Reset()
 		return nil, err
 	}
 
 	r := pbio.NewDelimitedReader(s, network.MessageSizeMax)
-	tctx, cancel := context.WithTimeout(ctx, ms.timeout)
+	tctx, cancel := context.WithTimeout(ctx, ms.cfg.requestTimeout)
 	defer cancel()
 	defer func() { _ = s.Close() }()
 
@@ -159,6 +265,48 @@ func (ms *dhtMsgSender) SendRequest(ctx context.Context, p peer.ID, pmes *dhtpb.
 	return msg, nil
 }
 
+func (ms *dhtMsgSender) newStream(ctx context.Context, p peer.ID) (network.Stream, error) {
+	if ms.cfg.streamOpenTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ms.cfg.streamOpenTimeout)
+		defer cancel()
+	}
+	return ms.h.NewStream(ctx, p, ms.protocols...)
+}
+
+// withRetries runs send until it succeeds or the configured number of retries is used up, reporting every attempt
+func (ms *dhtMsgSender) withRetries(ctx context.Context, p peer.ID, pmes *dhtpb.Message, send func() error) error {
+	// always make at least one attempt, so a nil error comes with a response
+	maxAttempts := max(ms.cfg.retries, 0) + 1
+	backoff := ms.cfg.backoff
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		start := time.Now()
+		err = send()
+		if ms.cfg.onAttempt != nil {
+			ms.cfg.onAttempt(DhtAttempt{
+				Peer:        p,
+				Type:        pmes.GetType(),
+				Attempt:     attempt,
+				MaxAttempts: maxAttempts,
+				Duration:    time.Since(start),
+				Err:         err,
+			})
+		}
+		if err == nil || attempt == maxAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+	return err
+}
+
 func ctxReadMsg(ctx context.Context, rc pbio.ReadCloser, mes *dhtpb.Message) error {
 	errc := make(chan error, 1)
 	go func(r pbio.ReadCloser) {
@@ -177,7 +325,13 @@ func ctxReadMsg(ctx context.Context, rc pbio.ReadCloser, mes *dhtpb.Message) err
 
 // SendMessage sends a peer a message without waiting on a response
 func (ms *dhtMsgSender) SendMessage(ctx context.Context, p peer.ID, pmes *dhtpb.Message) error {
-	s, err := ms.h.NewStream(ctx, p, ms.protocols...)
+	return ms.withRetries(ctx, p, pmes, func() error {
+		return ms.sendMessage(ctx, p, pmes)
+	})
+}
+
+func (ms *dhtMsgSender) sendMessage(ctx context.Context, p peer.ID, pmes *dhtpb.Message) error {
+	s, err := ms.newStream(ctx, p)
 	if err != nil {
 		return err
 	}
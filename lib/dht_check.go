@@ -0,0 +1,285 @@
+package vole
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	kb "github.com/libp2p/go-libp2p-kbucket"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/multiformats/go-multihash"
+
+	recpb "github.com/libp2p/go-libp2p-record/pb"
+)
+
+// DhtQueryKind selects what is asked of each DHT node when comparing them
+type DhtQueryKind string
+
+const (
+	// DhtQueryValue sends GET_VALUE requests for a record
+	DhtQueryValue DhtQueryKind = "value"
+	// DhtQueryProviders sends GET_PROVIDERS requests for provider records
+	DhtQueryProviders DhtQueryKind = "providers"
+)
+
+// dhtNodeQueryTimeout bounds how long a single node may take to be dialed and answer during lookups and comparisons
+const dhtNodeQueryTimeout = time.Second * 15
+
+// DhtNodeResult is the answer of a single DHT node to a GET_VALUE or GET_PROVIDERS request
+type DhtNodeResult struct {
+	Peer peer.ID
+	// Responded is false when the node could not be reached or the request failed, see Error
+	Responded bool
+	Record    *recpb.Record
+	// Sequence is the sequence number of the record if it is an IPNS record
+	Sequence *uint64
+	// ValueDigest is a short digest of the record value, identical values have identical digests
+	ValueDigest string
+	Providers   []*peer.AddrInfo
+	Error       error
+}
+
+// Holds reports whether the node returned the record or at least one provider
+func (r *DhtNodeResult) Holds() bool {
+	return r.Record != nil || len(r.Providers) > 0
+}
+
+// ClosestPeers runs an iterative kademlia lookup for the key starting from the client's target node.
+// It returns up to k of the peers closest to the key that answered the lookup, sorted by distance.
+func (c *DhtClient) ClosestPeers(ctx context.Context, key []byte, k int) ([]peer.AddrInfo, error) {
+	const alpha = 3
+
+	type lookupPeer struct {
+		queried, failed bool
+	}
+	target := kb.ConvertKey(string(key))
+	known := map[peer.ID]*lookupPeer{c.target: {}}
+
+	var mu sync.Mutex
+	for {
+		ids := make([]peer.ID, 0, len(known))
+		for p, lp := range known {
+			if !lp.failed {
+				ids = append(ids, p)
+			}
+		}
+		ids = kb.SortClosestPeers(ids, target)
+		if len(ids) > k {
+			ids = ids[:k]
+		}
+
+		var toQuery []peer.ID
+		for _, p := range ids {
+			if !known[p].queried && len(toQuery) < alpha {
+				toQuery = append(toQuery, p)
+			}
+		}
+		if len(toQuery) == 0 {
+			res := make([]peer.AddrInfo, 0, len(ids))
+			for _, p := range ids {
+				res = append(res, c.h.Peerstore().PeerInfo(p))
+			}
+			if len(res) == 0 {
+				return nil, errors.New("no peers answered the lookup")
+			}
+			return res, nil
+		}
+
+		var wg sync.WaitGroup
+		for _, p := range toQuery {
+			known[p].queried = true
+			wg.Add(1)
+			go func(p peer.ID) {
+				defer wg.Done()
+				tctx, cancel := context.WithTimeout(ctx, dhtNodeQueryTimeout)
+				defer cancel()
+				closer, err := c.m.GetClosestPeers(tctx, p, peer.ID(key))
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					known[p].failed = true
+					return
+				}
+				for _, ai := range closer {
+					if ai.ID == c.h.ID() {
+						continue
+					}
+					c.h.Peerstore().AddAddrs(ai.ID, ai.Addrs, peerstore.TempAddrTTL)
+					if _, ok := known[ai.ID]; !ok {
+						known[ai.ID] = &lookupPeer{}
+					}
+				}
+			}(p)
+		}
+		wg.Wait()
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// QueryNodes sends the same GET_VALUE or GET_PROVIDERS request for the key to each of the nodes concurrently.
+// Results are returned in the same order as the nodes.
+func (c *DhtClient) QueryNodes(ctx context.Context, kind DhtQueryKind, key []byte, nodes []peer.AddrInfo) []*DhtNodeResult {
+	results := make([]*DhtNodeResult, len(nodes))
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		c.h.Peerstore().AddAddrs(n.ID, n.Addrs, peerstore.TempAddrTTL)
+		wg.Add(1)
+		go func(i int, p peer.ID) {
+			defer wg.Done()
+			tctx, cancel := context.WithTimeout(ctx, dhtNodeQueryTimeout)
+			defer cancel()
+			results[i] = c.queryNode(tctx, kind, key, p)
+		}(i, n.ID)
+	}
+	wg.Wait()
+	return results
+}
+
+func (c *DhtClient) queryNode(ctx context.Context, kind DhtQueryKind, key []byte, p peer.ID) *DhtNodeResult {
+	res := &DhtNodeResult{Peer: p}
+	switch kind {
+	case DhtQueryValue:
+		rec, _, err := c.m.GetValue(ctx, p, string(key))
+		if err != nil {
+			res.Error = err
+			return res
+		}
+		res.Responded = true
+		if rec == nil || len(rec.GetValue()) == 0 {
+			return res
+		}
+		res.Record = rec
+		digest := sha256.Sum256(rec.GetValue())
+		res.ValueDigest = hex.EncodeToString(digest[:8])
+		if strings.HasPrefix(string(key), "/ipns/") {
+			if ipnsRec, err := ipns.UnmarshalRecord(rec.GetValue()); err == nil {
+				if seq, err := ipnsRec.Sequence(); err == nil {
+					res.Sequence = &seq
+				}
+			}
+		}
+	case DhtQueryProviders:
+		provs, _, err := c.m.GetProviders(ctx, p, multihash.Multihash(key))
+		if err != nil {
+			res.Error = err
+			return res
+		}
+		res.Responded = true
+		res.Providers = provs
+	default:
+		res.Error = errors.New("unknown query kind " + string(kind))
+	}
+	return res
+}
+
+// DhtChangeKind describes how a node's answer changed between two rounds of WatchNodes
+type DhtChangeKind string
+
+const (
+	DhtRecordAppeared    DhtChangeKind = "appeared"
+	DhtRecordChanged     DhtChangeKind = "changed"
+	DhtRecordDisappeared DhtChangeKind = "disappeared"
+)
+
+// DhtNodeChange is a change in what a single node holds for the watched key
+type DhtNodeChange struct {
+	Peer     peer.ID
+	Kind     DhtChangeKind
+	Previous *DhtNodeResult
+	Current  *DhtNodeResult
+}
+
+// DhtWatchRound is the outcome of one round of WatchNodes
+type DhtWatchRound struct {
+	Time    time.Time
+	Round   int
+	Results []*DhtNodeResult
+	Changes []DhtNodeChange
+	// Holders is the number of nodes known to hold the record or providers, nodes that failed to answer keep their last known state
+	Holders int
+}
+
+// WatchNodes queries the nodes for the key every interval, reporting what changed since the previous round.
+// In the first round every node holding the record is reported as having it appear.
+// It runs until the context is done or onRound returns true.
+func (c *DhtClient) WatchNodes(ctx context.Context, kind DhtQueryKind, key []byte, nodes []peer.AddrInfo, interval time.Duration, onRound func(DhtWatchRound) bool) error {
+	last := make(map[peer.ID]*DhtNodeResult)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for round := 1; ; round++ {
+		results := c.QueryNodes(ctx, kind, key, nodes)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		r := DhtWatchRound{Time: time.Now(), Round: round, Results: results}
+		for _, cur := range results {
+			// a node failing to answer says nothing about whether it still holds the record
+			if !cur.Responded {
+				continue
+			}
+			if ch, ok := DiffDhtNodeResult(last[cur.Peer], cur); ok {
+				r.Changes = append(r.Changes, ch)
+			}
+			last[cur.Peer] = cur
+		}
+		for _, res := range last {
+			if res.Holds() {
+				r.Holders++
+			}
+		}
+
+		if onRound(r) {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// DiffDhtNodeResult compares two answers of the same node, prev may be nil if the node has not answered before
+func DiffDhtNodeResult(prev, cur *DhtNodeResult) (DhtNodeChange, bool) {
+	ch := DhtNodeChange{Peer: cur.Peer, Previous: prev, Current: cur}
+	prevHolds := prev != nil && prev.Holds()
+	switch {
+	case !prevHolds && cur.Holds():
+		ch.Kind = DhtRecordAppeared
+	case prevHolds && !cur.Holds():
+		ch.Kind = DhtRecordDisappeared
+	case prevHolds && cur.Holds() && !sameHoldings(prev, cur):
+		ch.Kind = DhtRecordChanged
+	default:
+		return DhtNodeChange{}, false
+	}
+	return ch, true
+}
+
+func sameHoldings(a, b *DhtNodeResult) bool {
+	if a.ValueDigest != b.ValueDigest || len(a.Providers) != len(b.Providers) {
+		return false
+	}
+	provs := make(map[peer.ID]struct{}, len(a.Providers))
+	for _, p := range a.Providers {
+		provs[p.ID] = struct{}{}
+	}
+	for _, p := range b.Providers {
+		if _, ok := provs[p.ID]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package vole
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+
+	recpb "github.com/libp2p/go-libp2p-record/pb"
+)
+
+func TestDhtClosestPeersAndQueryNodes(t *testing.T) {
+	defer func() { _ = SetHostConfig(HostConfig{}) }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := SetHostConfig(HostConfig{ListenAddrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/0")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	const proto = "/test/kad/1.0.0"
+	var servers []*DhtServer
+	var bootstrap []peer.AddrInfo
+	for i := 0; i < 4; i++ {
+		s, err := NewDhtServer(ctx, DhtServerConfig{
+			Protocol:       proto,
+			BootstrapPeers: bootstrap,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		servers = append(servers, s)
+		bootstrap = append(bootstrap, s.AddrInfo())
+	}
+	// make sure every server knows about all the others before looking them up
+	for _, s := range servers {
+		<-s.d.RefreshRoutingTable()
+	}
+
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := []byte("/pk/" + string(p))
+	v, err := crypto.MarshalPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only store the record on the first two servers
+	for _, s := range servers[:2] {
+		ai := s.AddrInfo()
+		if err := DhtPut(ctx, k, v, proto, mustP2pAddr(t, ai)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entry := servers[3].AddrInfo()
+	c, err := NewDhtClient(ctx, proto, &entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	closest, err := c.ClosestPeers(ctx, k, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closest) != len(servers) {
+		t.Fatalf("expected the lookup to find all %d servers, found %d", len(servers), len(closest))
+	}
+
+	holders := map[peer.ID]bool{servers[0].h.ID(): true, servers[1].h.ID(): true}
+	results := c.QueryNodes(ctx, DhtQueryValue, k, closest)
+	for _, r := range results {
+		if !r.Responded {
+			t.Fatalf("expected %s to respond, got %v", r.Peer, r.Error)
+		}
+		if r.Holds() != holders[r.Peer] {
+			t.Fatalf("expected %s holding the record to be %v", r.Peer, holders[r.Peer])
+		}
+	}
+	if results[0].Holds() && results[0].ValueDigest == "" {
+		t.Fatal("expected a value digest for a held record")
+	}
+}
+
+func TestDiffDhtNodeResult(t *testing.T) {
+	const p = peer.ID("node")
+	missing := &DhtNodeResult{Peer: p, Responded: true}
+	v1 := &DhtNodeResult{Peer: p, Responded: true, Record: &recpb.Record{Value: []byte("1")}, ValueDigest: "01"}
+	v2 := &DhtNodeResult{Peer: p, Responded: true, Record: &recpb.Record{Value: []byte("2")}, ValueDigest: "02"}
+	provsA := &DhtNodeResult{Peer: p, Responded: true, Providers: []*peer.AddrInfo{{ID: "a"}}}
+	provsAB := &DhtNodeResult{Peer: p, Responded: true, Providers: []*peer.AddrInfo{{ID: "b"}, {ID: "a"}}}
+	provsBA := &DhtNodeResult{Peer: p, Responded: true, Providers: []*peer.AddrInfo{{ID: "a"}, {ID: "b"}}}
+
+	for _, tc := range []struct {
+		name      string
+		prev, cur *DhtNodeResult
+		changed   bool
+		kind      DhtChangeKind
+	}{
+		{"first answer missing", nil, missing, false, ""},
+		{"first answer holds", nil, v1, true, DhtRecordAppeared},
+		{"appeared", missing, v1, true, DhtRecordAppeared},
+		{"unchanged", v1, v1, false, ""},
+		{"new version", v1, v2, true, DhtRecordChanged},
+		{"expired", v2, missing, true, DhtRecordDisappeared},
+		{"provider added", provsA, provsAB, true, DhtRecordChanged},
+		{"providers reordered", provsAB, provsBA, false, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ch, changed := DiffDhtNodeResult(tc.prev, tc.cur)
+			if changed != tc.changed {
+				t.Fatalf("expected changed to be %v", tc.changed)
+			}
+			if ch.Kind != tc.kind {
+				t.Fatalf("expected change %q, got %q", tc.kind, ch.Kind)
+			}
+		})
+	}
+}
+
+func mustP2pAddr(t *testing.T, ai peer.AddrInfo) multiaddr.Multiaddr {
+	t.Helper()
+	addrs, err := peer.AddrInfoToP2pAddrs(&ai)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addrs[0]
+}
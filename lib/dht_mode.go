@@ -0,0 +1,108 @@
+package vole
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// DhtMode is the role a peer plays in a DHT
+type DhtMode string
+
+const (
+	// DhtModeServer means the peer advertises the DHT protocol and answers requests
+	DhtModeServer DhtMode = "server"
+	// DhtModeClientOnly means the peer does not advertise the DHT protocol, so it only uses the DHT without serving it
+	DhtModeClientOnly DhtMode = "client-only"
+	// DhtModeUnresponsive means the peer advertises the DHT protocol but did not answer any request
+	DhtModeUnresponsive DhtMode = "advertises but does not answer"
+)
+
+// DhtModeProbe is the result of checking whether a peer is acting as a DHT server
+type DhtModeProbe struct {
+	PeerId       peer.ID
+	AgentVersion string
+	Mode         DhtMode
+	// Advertised is set when the peer listed the DHT protocol in its identify response
+	Advertised bool
+	// PingErr and FindNodeErr are the outcomes of the requests sent to confirm an advertised DHT protocol
+	PingErr     error
+	PingRTT     time.Duration
+	FindNodeErr error
+	CloserPeers int
+}
+
+func (o *DhtModeProbe) MarshalJSON() ([]byte, error) {
+	errString := func(err error) *string {
+		if err == nil {
+			return nil
+		}
+		m := err.Error()
+		return &m
+	}
+	type dhtModeProbe DhtModeProbe
+	anon := struct {
+		*dhtModeProbe
+		PingErr     *string
+		PingRTT     string
+		FindNodeErr *string
+	}{
+		dhtModeProbe: (*dhtModeProbe)(o),
+		PingErr:      errString(o.PingErr),
+		PingRTT:      o.PingRTT.String(),
+		FindNodeErr:  errString(o.FindNodeErr),
+	}
+	return json.Marshal(anon)
+}
+
+var _ json.Marshaler = (*DhtModeProbe)(nil)
+
+// ProbeDhtMode connects to the peer, looks for the DHT protocol in what it advertised over identify
+// and, if it is there, confirms the peer answers by sending it a PING and a FIND_NODE request.
+// Peers that answer either request are servers, as not every implementation supports PING.
+func ProbeDhtMode(ctx context.Context, proto protocol.ID, ai *peer.AddrInfo, opts ...DhtOption) (*DhtModeProbe, error) {
+	c, err := NewDhtClient(ctx, proto, ai, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	info, err := extractIdentifyInfo(c.h.Peerstore(), ai.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &DhtModeProbe{
+		PeerId:       ai.ID,
+		AgentVersion: info.AgentVersion,
+		Mode:         DhtModeClientOnly,
+	}
+	for _, p := range info.Protocols {
+		if p == proto {
+			res.Advertised = true
+		}
+	}
+	if !res.Advertised {
+		return res, nil
+	}
+
+	start := time.Now()
+	res.PingErr = c.Ping(ctx)
+	if res.PingErr == nil {
+		res.PingRTT = time.Since(start)
+	}
+
+	// ask for peers close to ourselves, any key works but this one is guaranteed to be valid
+	closer, err := c.GetClosestPeers(ctx, []byte(c.h.ID()))
+	res.FindNodeErr = err
+	res.CloserPeers = len(closer)
+
+	res.Mode = DhtModeUnresponsive
+	if res.PingErr == nil || res.FindNodeErr == nil {
+		res.Mode = DhtModeServer
+	}
+	return res, nil
+}
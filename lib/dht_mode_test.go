@@ -0,0 +1,66 @@
+package vole
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestProbeDhtMode(t *testing.T) {
+	defer func() { _ = SetHostConfig(HostConfig{}) }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := SetHostConfig(HostConfig{ListenAddrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/0")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	const proto = "/test/kad/1.0.0"
+	s, err := NewDhtServer(ctx, DhtServerConfig{
+		Protocol: proto,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	newHost := func() host.Host {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	client := newHost()
+	defer client.Close()
+	// accepts the protocol but never answers
+	silent := newHost()
+	defer silent.Close()
+	silent.SetStreamHandler(proto, func(s network.Stream) { _ = s.Reset() })
+
+	server := s.AddrInfo()
+	for _, tc := range []struct {
+		name     string
+		ai       peer.AddrInfo
+		expected DhtMode
+	}{
+		{"server", server, DhtModeServer},
+		{"client", peer.AddrInfo{ID: client.ID(), Addrs: client.Addrs()}, DhtModeClientOnly},
+		{"silent", peer.AddrInfo{ID: silent.ID(), Addrs: silent.Addrs()}, DhtModeUnresponsive},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := ProbeDhtMode(ctx, proto, &tc.ai, DhtRequestTimeout(time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Mode != tc.expected {
+				t.Fatalf("expected mode %q, got %q (ping: %v, find node: %v)", tc.expected, res.Mode, res.PingErr, res.FindNodeErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package vole
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	leveldb "github.com/ipfs/go-ds-leveldb"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	dhtpb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+// DhtServerConfig configures a DhtServer
+type DhtServerConfig struct {
+	// Protocol is the DHT protocol ID to serve, defaults to /ipfs/kad/1.0.0
+	Protocol protocol.ID
+	// BootstrapPeers are connected to and added to the routing table on startup
+	BootstrapPeers []peer.AddrInfo
+	// DatastorePath is the directory of a leveldb datastore holding the records, if empty an in-memory datastore is used
+	DatastorePath string
+	// OnMessage is called for every request the server receives and every response it sends, possibly concurrently
+	OnMessage func(DhtServerMessage)
+}
+
+// DhtServerMessage is a DHT message received or sent by a DhtServer
+type DhtServerMessage struct {
+	Time time.Time
+	Peer peer.ID
+	// Inbound is true for requests received from the peer and false for responses sent to it
+	Inbound bool
+	Message *dhtpb.Message
+}
+
+// DhtServer is a DHT node running in server mode
+type DhtServer struct {
+	h  host.Host
+	d  *dht.IpfsDHT
+	ds datastore.Batching
+}
+
+// NewDhtServer starts a DHT server on a new libp2p host, it runs until closed
+func NewDhtServer(ctx context.Context, cfg DhtServerConfig) (*DhtServer, error) {
+	protoID := cfg.Protocol
+	if protoID == "" {
+		protoID = "/ipfs/kad/1.0.0"
+	}
+
+	var ds datastore.Batching = dssync.MutexWrap(datastore.NewMapDatastore())
+	if cfg.DatastorePath != "" {
+		lds, err := leveldb.NewDatastore(cfg.DatastorePath, nil)
+		if err != nil {
+			return nil, err
+		}
+		ds = lds
+	}
+
+	h, err := libp2pHost()
+	if err != nil {
+		_ = ds.Close()
+		return nil, err
+	}
+
+	var dhtHost host.Host = h
+	if cfg.OnMessage != nil {
+		dhtHost = &tappedHost{Host: h, onMessage: cfg.OnMessage}
+	}
+
+	d, err := dht.New(ctx, dhtHost,
+		dht.Mode(dht.ModeServer),
+		dht.V1ProtocolOverride(protoID),
+		dht.Datastore(ds),
+		dht.BootstrapPeers(cfg.BootstrapPeers...),
+	)
+	if err != nil {
+		_ = h.Close()
+		_ = ds.Close()
+		return nil, err
+	}
+
+	if len(cfg.BootstrapPeers) > 0 {
+		if err := d.Bootstrap(ctx); err != nil {
+			_ = d.Close()
+			_ = h.Close()
+			_ = ds.Close()
+			return nil, err
+		}
+	}
+
+	return &DhtServer{h: h, d: d, ds: ds}, nil
+}
+
+// AddrInfo returns the peer ID and listen addresses of the server
+func (s *DhtServer) AddrInfo() peer.AddrInfo {
+	return peer.AddrInfo{ID: s.h.ID(), Addrs: s.h.Addrs()}
+}
+
+// Close stops the DHT, its host and its datastore
+func (s *DhtServer) Close() error {
+	dErr := s.d.Close()
+	hErr := s.h.Close()
+	dsErr := s.ds.Close()
+	for _, err := range []error{dErr, hErr, dsErr} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tappedHost wraps the stream handlers registered on it so that the DHT messages flowing over their streams are reported
+type tappedHost struct {
+	host.Host
+	onMessage func(DhtServerMessage)
+}
+
+func (h *tappedHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	h.Host.SetStreamHandler(pid, func(s network.Stream) {
+		handler(&tappedStream{
+			Stream: s,
+			in:     &msgTap{peer: s.Conn().RemotePeer(), inbound: true, onMessage: h.onMessage},
+			out:    &msgTap{peer: s.Conn().RemotePeer(), inbound: false, onMessage: h.onMessage},
+		})
+	})
+}
+
+// tappedStream decodes the DHT messages read from and written to a stream as they pass through it
+type tappedStream struct {
+	network.Stream
+	in, out *msgTap
+}
+
+func (s *tappedStream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+	s.in.write(b[:n])
+	return n, err
+}
+
+func (s *tappedStream) Write(b []byte) (int, error) {
+	n, err := s.Stream.Write(b)
+	s.out.write(b[:n])
+	return n, err
+}
+
+// msgTap reassembles varint length prefixed DHT messages from the bytes written to it and reports each complete one
+type msgTap struct {
+	peer      peer.ID
+	inbound   bool
+	onMessage func(DhtServerMessage)
+	buf       []byte
+	broken    bool
+}
+
+func (t *msgTap) write(b []byte) {
+	if t.broken {
+		return
+	}
+	t.buf = append(t.buf, b...)
+	for {
+		size, n := binary.Uvarint(t.buf)
+		if n < 0 || size > network.MessageSizeMax {
+			t.broken = true
+			t.buf = nil
+			return
+		}
+		if n == 0 || uint64(len(t.buf)-n) < size {
+			return
+		}
+
+		msg := new(dhtpb.Message)
+		if err := proto.Unmarshal(t.buf[n:n+int(size)], msg); err != nil {
+			t.broken = true
+			t.buf = nil
+			return
+		}
+		t.buf = t.buf[n+int(size):]
+		t.onMessage(DhtServerMessage{
+			Time:    time.Now(),
+			Peer:    t.peer,
+			Inbound: t.inbound,
+			Message: msg,
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package vole
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	dhtpb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestDhtServer(t *testing.T) {
+	defer func() { _ = SetHostConfig(HostConfig{}) }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := SetHostConfig(HostConfig{ListenAddrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/0")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var msgs []DhtServerMessage
+
+	dsPath := t.TempDir()
+	cfg := DhtServerConfig{
+		Protocol:      "/test/kad/1.0.0",
+		DatastorePath: dsPath,
+		OnMessage: func(m DhtServerMessage) {
+			mu.Lock()
+			defer mu.Unlock()
+			msgs = append(msgs, m)
+		},
+	}
+	s, err := NewDhtServer(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the default /pk validator only accepts public keys matching the peer ID in the key
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := []byte("/pk/" + string(p))
+	v, err := crypto.MarshalPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ai := s.AddrInfo()
+	c, err := NewDhtClient(ctx, cfg.Protocol, &ai)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Put(ctx, k, v); err != nil {
+		t.Fatal(err)
+	}
+
+	// the response is reported asynchronously so it may arrive after the client has received it
+	var sawRequest, sawResponse bool
+	for start := time.Now(); time.Since(start) < time.Second*5; time.Sleep(time.Millisecond * 10) {
+		mu.Lock()
+		for _, m := range msgs {
+			if m.Message.GetType() != dhtpb.Message_PUT_VALUE || m.Peer != c.h.ID() {
+				continue
+			}
+			if m.Inbound {
+				sawRequest = true
+			} else {
+				sawResponse = true
+			}
+		}
+		mu.Unlock()
+		if sawRequest && sawResponse {
+			break
+		}
+	}
+	if !sawRequest || !sawResponse {
+		t.Fatalf("expected the put request and response to be reported, got request=%v response=%v", sawRequest, sawResponse)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the record should survive a restart when using an on-disk datastore
+	cfg.OnMessage = nil
+	s, err = NewDhtServer(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ai = s.AddrInfo()
+	c2, err := NewDhtClient(ctx, cfg.Protocol, &ai)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	rec, err := c2.Get(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rec.GetValue(), v) {
+		t.Fatal("record values not equal")
+	}
+}
@@ -3,13 +3,18 @@ package vole
 import (
 	"bytes"
 	"context"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/libp2p/go-libp2p"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
+	dhtpb "github.com/libp2p/go-libp2p-kad-dht/pb"
 	record "github.com/libp2p/go-libp2p-record"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-msgio/pbio"
 )
 
 func TestDhtPutGet(t *testing.T) {
@@ -56,6 +61,126 @@ func TestDhtPutGet(t *testing.T) {
 	}
 }
 
+func TestDhtClientReusesConnection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	nsval := record.NamespacedValidator{}
+	nsval["testval"] = &testVal{}
+
+	d, err := dht.New(ctx, h, dht.Mode(dht.ModeServer), dht.ProtocolPrefix("/test"), dht.Validator(nsval))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	c, err := NewDhtClient(ctx, "/test/kad/1.0.0", &peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := []byte("/testval/fookey")
+	v := []byte("the data")
+	if err := c.Put(ctx, k, v); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := c.Get(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rec.GetValue(), v) {
+		t.Fatal("record values not equal")
+	}
+
+	if n := len(h.Network().ConnsToPeer(c.h.ID())); n != 1 {
+		t.Fatalf("expected a single connection from the client, got %d", n)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDhtClientRetries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// drop the first request and answer the following ones
+	proto := protocol.ID("/test/kad/1.0.0")
+	var requests atomic.Int32
+	h.SetStreamHandler(proto, func(s network.Stream) {
+		defer s.Close()
+		msg := new(dhtpb.Message)
+		if err := pbio.NewDelimitedReader(s, network.MessageSizeMax).ReadMsg(msg); err != nil {
+			_ = s.Reset()
+			return
+		}
+		if requests.Add(1) == 1 {
+			_ = s.Reset()
+			return
+		}
+		_ = pbio.NewDelimitedWriter(s).WriteMsg(msg)
+	})
+
+	var attempts []DhtAttempt
+	c, err := NewDhtClient(ctx, proto, &peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()},
+		DhtRequestTimeout(time.Second),
+		DhtRetries(2, time.Millisecond),
+		DhtAttemptReporter(func(a DhtAttempt) { attempts = append(attempts, a) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(attempts) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(attempts))
+	}
+	if attempts[0].Err == nil || attempts[1].Err != nil {
+		t.Fatalf("expected only the first attempt to fail, got %v and %v", attempts[0].Err, attempts[1].Err)
+	}
+	if attempts[1].Attempt != 2 || attempts[1].MaxAttempts != 3 || attempts[1].Type != dhtpb.Message_PING {
+		t.Fatalf("unexpected attempt report %+v", attempts[1])
+	}
+
+	// a negative number of retries still makes one attempt, and a timeout of 0 keeps the default
+	attempts = nil
+	c2, err := NewDhtClient(ctx, proto, &peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()},
+		DhtRequestTimeout(0),
+		DhtRetries(-1, time.Millisecond),
+		DhtAttemptReporter(func(a DhtAttempt) { attempts = append(attempts, a) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	if err := c2.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 1 || attempts[0].MaxAttempts != 1 {
+		t.Fatalf("expected a single attempt, got %+v", attempts)
+	}
+}
+
 type testVal struct{}
 
 func (n *testVal) Validate(key string, value []byte) error {
@@ -0,0 +1,171 @@
+package vole
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/sec"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// bogusPeerID is dialed to learn the actual ID of a peer from the failed security handshake
+var bogusPeerID = func() peer.ID {
+	p, err := peer.Decode("QmadAdJ3f63JyNs65X7HHzqDwV53ynvCcKtNFvdNaz3nhk")
+	if err != nil {
+		panic("the hard coded bogus peerID is invalid")
+	}
+	return p
+}()
+
+// PeerDiscoveryError is returned when the ID of the peer at an address could not be learned.
+// It lists why discovery failed for each of the addresses that were dialed, a DNS address may resolve to several.
+type PeerDiscoveryError struct {
+	Addr   multiaddr.Multiaddr
+	Reason string
+	Errors []swarm.TransportError
+}
+
+func (e *PeerDiscoveryError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "could not discover the peer ID at %s: %s", e.Addr, e.Reason)
+	for _, te := range e.Errors {
+		fmt.Fprintf(&b, "\n  * [%s] %s", te.Address, te.Cause)
+	}
+	return b.String()
+}
+
+// discoverPeer connects to the address without knowing the ID of the peer there.
+// WebSocket and secure WebSocket addresses run the libp2p handshake over the WebSocket like TCP does, the TLS certificate of a
+// secure WebSocket must verify before that. WebTransport addresses without certificate hashes are dialed with the hashes the peer advertises over QUIC on the same port.
+func (id *identifier) discoverPeer(ctx context.Context, ma multiaddr.Multiaddr) (*peer.AddrInfo, error) {
+	if _, err := ma.ValueForProtocol(multiaddr.P_CIRCUIT); err == nil {
+		return nil, &PeerDiscoveryError{Addr: ma, Reason: "the ID of a peer behind a relay is needed to ask the relay to connect to it"}
+	}
+	if isWebTransport, certhashes := webTransportCerthashCount(ma); isWebTransport && certhashes == 0 {
+		return id.discoverWebTransportPeer(ctx, ma)
+	}
+
+	p, err := id.discoverPeerID(ctx, ma)
+	if err != nil {
+		return nil, err
+	}
+	ai := &peer.AddrInfo{ID: p, Addrs: []multiaddr.Multiaddr{ma}}
+	if err := id.h.Connect(ctx, *ai); err != nil {
+		return nil, err
+	}
+	return ai, nil
+}
+
+// discoverPeerID dials the bogus peer ID at the address and reads the actual peer ID from the failed handshake
+func (id *identifier) discoverPeerID(ctx context.Context, ma multiaddr.Multiaddr) (peer.ID, error) {
+	id.unknownPeerMu.Lock()
+	err := id.h.Connect(ctx, peer.AddrInfo{ID: bogusPeerID, Addrs: []multiaddr.Multiaddr{ma}})
+	// don't let the next lookup dial this address too, or be refused because this one failed
+	id.h.Peerstore().ClearAddrs(bogusPeerID)
+	if s, ok := id.h.Network().(*swarm.Swarm); ok {
+		s.Backoff().Clear(bogusPeerID)
+	}
+	id.unknownPeerMu.Unlock()
+	if err == nil {
+		return "", &PeerDiscoveryError{Addr: ma, Reason: "the peer accepted the bogus peer ID, its security protocol does not authenticate peers"}
+	}
+
+	p, err := extractPeerIDFromError(err)
+	if err != nil {
+		var dErr *PeerDiscoveryError
+		if errors.As(err, &dErr) {
+			dErr.Addr = ma
+		}
+		return "", err
+	}
+	return p, nil
+}
+
+// discoverWebTransportPeer learns the peer ID and certificate hashes of a WebTransport address over QUIC, which go-libp2p serves on the same port
+func (id *identifier) discoverWebTransportPeer(ctx context.Context, ma multiaddr.Multiaddr) (*peer.AddrInfo, error) {
+	quicAddr, _ := multiaddr.SplitFunc(ma, func(c multiaddr.Component) bool {
+		return c.Protocol().Code == multiaddr.P_WEBTRANSPORT
+	})
+	p, err := id.discoverPeerID(ctx, quicAddr)
+	if err != nil {
+		return nil, &PeerDiscoveryError{
+			Addr:   ma,
+			Reason: fmt.Sprintf("WebTransport cannot be dialed without certificate hashes and they could not be fetched over QUIC: %v", err),
+		}
+	}
+	if err := id.h.Connect(ctx, peer.AddrInfo{ID: p, Addrs: []multiaddr.Multiaddr{quicAddr}}); err != nil {
+		return nil, err
+	}
+
+	// identify has run as part of connecting, so the peerstore holds the addresses the peer advertised
+	var wtAddr multiaddr.Multiaddr
+	for _, a := range id.h.Peerstore().Addrs(p) {
+		withoutCerthashes, _ := multiaddr.SplitFunc(a, func(c multiaddr.Component) bool {
+			return c.Protocol().Code == multiaddr.P_CERTHASH
+		})
+		if withoutCerthashes.Equal(ma) {
+			wtAddr = a
+			break
+		}
+	}
+	// only measure the WebTransport connection from here on
+	_ = id.h.Network().ClosePeer(p)
+	if wtAddr == nil {
+		return nil, &PeerDiscoveryError{Addr: ma, Reason: fmt.Sprintf("%s does not advertise a WebTransport address with certificate hashes matching the address", p)}
+	}
+
+	ai := &peer.AddrInfo{ID: p, Addrs: []multiaddr.Multiaddr{wtAddr}}
+	if err := id.h.Connect(ctx, *ai); err != nil {
+		return nil, err
+	}
+	return ai, nil
+}
+
+// webTransportCerthashCount reports whether the address is a WebTransport address and how many certificate hashes it contains
+func webTransportCerthashCount(ma multiaddr.Multiaddr) (bool, int) {
+	isWebTransport, certhashes := false, 0
+	for _, c := range ma {
+		switch c.Protocol().Code {
+		case multiaddr.P_WEBTRANSPORT:
+			isWebTransport = true
+		case multiaddr.P_CERTHASH:
+			certhashes++
+		}
+	}
+	return isWebTransport, certhashes
+}
+
+// extractPeerIDFromError looks through the errors of every dialed address for a handshake that failed because the peer ID did not match
+func extractPeerIDFromError(inputErr error) (peer.ID, error) {
+	var dialErr *swarm.DialError
+	if !errors.As(inputErr, &dialErr) {
+		return "", inputErr
+	}
+
+	for _, te := range dialErr.DialErrors {
+		var peerIDMismatchErr sec.ErrPeerIDMismatch
+		if errors.As(te.Cause, &peerIDMismatchErr) {
+			return peerIDMismatchErr.Actual, nil
+		}
+	}
+
+	reason := "no address completed a security handshake"
+	if len(dialErr.DialErrors) == 0 && dialErr.Cause != nil {
+		reason = dialErr.Cause.Error()
+	}
+	for _, te := range dialErr.DialErrors {
+		// secure WebSocket runs TLS with a web certificate before the libp2p handshake that would reveal the peer ID
+		var certErr *tls.CertificateVerificationError
+		if errors.As(te.Cause, &certErr) {
+			reason = "the TLS certificate of the secure WebSocket address could not be verified, " +
+				"use a /dns address or /tls/sni/<name>/ws with the name the certificate is for"
+			break
+		}
+	}
+	return "", &PeerDiscoveryError{Reason: reason, Errors: dialErr.DialErrors}
+}
@@ -0,0 +1,171 @@
+package vole
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// holePunchRetries is how many times the libp2p hole puncher tries before giving up
+const holePunchRetries = 3
+
+// HolePunchReport is the outcome of the DCUtR hole punch a peer connected to over a relay did with us
+type HolePunchReport struct {
+	// Started is set when the peer started coordinating a hole punch over the relayed connection
+	Started  bool
+	Attempts int
+	Success  bool
+	// Duration is the time from the start of the first attempt to the end of the last one
+	Duration time.Duration
+	// RemoteAddrs are the addresses of the peer the hole punch was tried on
+	RemoteAddrs []multiaddr.Multiaddr
+	// Error is why the last attempt failed
+	Error error
+	// Direct is set when we ended up with a direct connection to the peer, by hole punching or otherwise
+	Direct bool
+	Conn   *ConnInfo
+}
+
+// Print writes the outcome of the hole punch, one detail per line
+func (o *HolePunchReport) Print() {
+	fmt.Println("Hole punch:")
+	if !o.Started {
+		fmt.Println("\tStarted: false")
+	} else {
+		fmt.Printf("\tSuccess: %t\n", o.Success)
+		fmt.Printf("\tAttempts: %d\n", o.Attempts)
+		fmt.Printf("\tDuration: %s\n", o.Duration)
+		fmt.Println("\tAddresses tried:")
+		for _, a := range o.RemoteAddrs {
+			fmt.Printf("\t\t- %s\n", a)
+		}
+	}
+	if o.Error != nil {
+		fmt.Printf("\tError: %v\n", o.Error)
+	}
+	fmt.Printf("\tDirect connection: %t\n", o.Direct)
+	if o.Conn != nil {
+		fmt.Printf("\tDirect address: %s\n", o.Conn.RemoteAddr)
+	}
+}
+
+// holePunchTracer passes the hole punching events of a host on to a channel, dropping them when it is full
+type holePunchTracer struct {
+	events chan *holepunch.Event
+}
+
+func newHolePunchTracer() *holePunchTracer {
+	return &holePunchTracer{events: make(chan *holepunch.Event, 32)}
+}
+
+func (t *holePunchTracer) Trace(evt *holepunch.Event) {
+	select {
+	case t.events <- evt:
+	default:
+	}
+}
+
+var _ holepunch.EventTracer = (*holePunchTracer)(nil)
+
+// waitForHolePunch follows the hole punching events for the peer until we get a direct connection to it,
+// the hole puncher gives up or the timeout expires
+func waitForHolePunch(ctx context.Context, h host.Host, p peer.ID, events <-chan *holepunch.Event, timeout time.Duration) *HolePunchReport {
+	report := &HolePunchReport{}
+
+	// the peer may also reach us with a plain direct dial, which is not traced on our side
+	connected := make(chan struct{}, 1)
+	notifee := &network.NotifyBundle{ConnectedF: func(_ network.Network, c network.Conn) {
+		if c.RemotePeer() != p || c.Stat().Limited {
+			return
+		}
+		select {
+		case connected <- struct{}{}:
+		default:
+		}
+	}}
+	h.Network().Notify(notifee)
+	defer h.Network().StopNotify(notifee)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var start time.Time
+	failures := 0
+	// handle applies the event to the report and tells whether the hole puncher is done
+	handle := func(e *holepunch.Event) bool {
+		if e.Remote != p {
+			return false
+		}
+		switch evt := e.Evt.(type) {
+		case *holepunch.StartHolePunchEvt:
+			if !report.Started {
+				start = time.Unix(0, e.Timestamp)
+			}
+			report.Started = true
+			for _, s := range evt.RemoteAddrs {
+				if a, err := multiaddr.NewMultiaddr(s); err == nil && !multiaddr.Contains(report.RemoteAddrs, a) {
+					report.RemoteAddrs = append(report.RemoteAddrs, a)
+				}
+			}
+		case *holepunch.HolePunchAttemptEvt:
+			report.Attempts++
+		case *holepunch.EndHolePunchEvt:
+			report.Duration = time.Unix(0, e.Timestamp).Sub(start)
+			if evt.Success {
+				report.Success = true
+				report.Error = nil
+				return true
+			}
+			report.Error = errors.New(evt.Error)
+			failures++
+			return failures == holePunchRetries
+		case *holepunch.ProtocolErrorEvt:
+			// the hole puncher does not retry after the coordination itself failed
+			report.Error = errors.New(evt.Error)
+			return true
+		}
+		return false
+	}
+
+	for done := false; !done; {
+		if directConn(h, p) != nil {
+			// pick up the events of the hole punch that brought the direct connection
+			for len(events) > 0 && !handle(<-events) {
+			}
+			break
+		}
+		select {
+		case e := <-events:
+			done = handle(e)
+		case <-connected:
+		case <-ctx.Done():
+			if !report.Started {
+				report.Error = fmt.Errorf("no hole punch within %s", timeout)
+			}
+			done = true
+		}
+	}
+
+	if c := directConn(h, p); c != nil {
+		report.Direct = true
+		report.Conn = NewConnInfo(c, nil)
+		report.Conn.HolePunched = report.Success
+	}
+	return report
+}
+
+// directConn returns a connection to the peer that does not go through a relay, if there is one
+func directConn(h host.Host, p peer.ID) network.Conn {
+	for _, c := range h.Network().ConnsToPeer(p) {
+		if !c.Stat().Limited && !isRelayedAddr(c.RemoteMultiaddr()) {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package vole
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
+)
+
+func TestWaitForHolePunch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h1.Close()
+	h2, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+
+	event := func(evt interface{}) *holepunch.Event {
+		return &holepunch.Event{Timestamp: time.Now().UnixNano(), Remote: h1.ID(), Evt: evt}
+	}
+	remoteAddrs := []string{"/ip4/1.2.3.4/udp/4001/quic-v1", "/ip4/1.2.3.4/tcp/4001"}
+
+	t.Run("failed", func(t *testing.T) {
+		events := make(chan *holepunch.Event, 16)
+		for i := 0; i < holePunchRetries; i++ {
+			events <- event(&holepunch.StartHolePunchEvt{RemoteAddrs: remoteAddrs})
+			events <- event(&holepunch.HolePunchAttemptEvt{Attempt: i + 1})
+			events <- event(&holepunch.EndHolePunchEvt{Error: "failed to dial"})
+		}
+		report := waitForHolePunch(ctx, h2, h1.ID(), events, time.Second*10)
+		if !report.Started || report.Success || report.Attempts != holePunchRetries || report.Error == nil || report.Direct {
+			t.Fatalf("expected %d failed attempts, got %+v", holePunchRetries, report)
+		}
+		if len(report.RemoteAddrs) != len(remoteAddrs) {
+			t.Fatalf("expected %d addresses to have been tried, got %v", len(remoteAddrs), report.RemoteAddrs)
+		}
+	})
+
+	t.Run("not started", func(t *testing.T) {
+		report := waitForHolePunch(ctx, h2, h1.ID(), make(chan *holepunch.Event), time.Millisecond*100)
+		if report.Started || report.Error == nil || report.Direct {
+			t.Fatalf("expected no hole punch, got %+v", report)
+		}
+	})
+
+	t.Run("succeeded", func(t *testing.T) {
+		events := make(chan *holepunch.Event, 16)
+		events <- event(&holepunch.StartHolePunchEvt{RemoteAddrs: remoteAddrs})
+		events <- event(&holepunch.HolePunchAttemptEvt{Attempt: 1})
+		if err := h2.Connect(ctx, peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}); err != nil {
+			t.Fatal(err)
+		}
+		events <- event(&holepunch.EndHolePunchEvt{Success: true})
+
+		report := waitForHolePunch(ctx, h2, h1.ID(), events, time.Second*10)
+		if !report.Success || report.Attempts != 1 || report.Error != nil {
+			t.Fatalf("expected a successful attempt, got %+v", report)
+		}
+		if !report.Direct || report.Conn == nil || report.Conn.Relayed || !report.Conn.HolePunched {
+			t.Fatalf("expected a hole punched direct connection, got %+v", report)
+		}
+	})
+}
@@ -0,0 +1,251 @@
+package vole
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
+	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
+	"github.com/libp2p/go-libp2p/p2p/security/noise"
+	tls "github.com/libp2p/go-libp2p/p2p/security/tls"
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	libp2pwebrtc "github.com/libp2p/go-libp2p/p2p/transport/webrtc"
+	ws "github.com/libp2p/go-libp2p/p2p/transport/websocket"
+	webtransport "github.com/libp2p/go-libp2p/p2p/transport/webtransport"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// hostTransports are the names of the transports HostConfig.Transports can enable
+var hostTransports = map[string]libp2p.Option{
+	"tcp":           libp2p.Transport(tcp.NewTCPTransport),
+	"quic":          libp2p.Transport(quic.NewTransport),
+	"webtransport":  libp2p.Transport(webtransport.New),
+	"websocket":     libp2p.Transport(ws.New),
+	"webrtc-direct": libp2p.Transport(libp2pwebrtc.New),
+}
+
+// privateNetworkTransports are the transports that work in a private network, the others bring their own encryption
+var privateNetworkTransports = map[string]bool{
+	"tcp":       true,
+	"websocket": true,
+}
+
+// hostSecurity are the security protocols HostConfig.Security can pick
+var hostSecurity = map[string]protocol.ID{
+	"tls":   tls.ID,
+	"noise": noise.ID,
+}
+
+// hostMuxers are the stream multiplexers HostConfig.Muxers can pick
+var hostMuxers = map[string]tptu.StreamMuxer{
+	"yamux": {ID: yamux.ID, Muxer: yamux.DefaultTransport},
+}
+
+// HostConfig configures the libp2p hosts vole creates. The zero value uses libp2p's defaults and a random identity.
+type HostConfig struct {
+	// PrivateKey is the identity of the hosts
+	PrivateKey crypto.PrivKey
+	// IdentityFile is where to load the identity of the hosts from, or save a new one to, when PrivateKey is not set.
+	// It is only read or created once the first host is, so commands that need no host leave it alone.
+	IdentityFile string
+	// ListenAddrs replace the default listen addresses
+	ListenAddrs []multiaddr.Multiaddr
+	// Transports, Security and Muxers are names of the ones to enable, in order of preference, all of them when empty.
+	// Transports are tcp, quic, webtransport, websocket and webrtc-direct, security protocols tls and noise, and the muxer is yamux.
+	Transports []string
+	Security   []string
+	Muxers     []string
+	UserAgent  string
+	// PSK is the pre-shared key of the private network to join, only tcp and websocket can be used in one
+	PSK pnet.PSK
+	// Relays are circuit relays to make reservations on, so that other peers can reach the hosts through them.
+	// Creating a host fails when none of the relays accepts a reservation.
+	Relays []peer.AddrInfo
+	// OnReservation is called for every reservation made, renewed or refused
+	OnReservation func(*RelayReservation)
+}
+
+var hostConfig HostConfig
+
+// loadedIdentity is the key of the latest HostConfig.IdentityFile, loaded when a host first needed it
+var loadedIdentity struct {
+	sync.Mutex
+	path string
+	key  crypto.PrivKey
+}
+
+// SetHostConfig configures the libp2p hosts created from then on.
+// The configuration is process wide and not guarded, so it is not safe to call while hosts are being created or concurrently with itself.
+// vole calls it once before running a command.
+func SetHostConfig(cfg HostConfig) error {
+	if _, err := cfg.options(); err != nil {
+		return err
+	}
+	hostConfig = cfg
+	return nil
+}
+
+// options returns the libp2p options for everything but the identity, see identity
+func (cfg HostConfig) options() ([]libp2p.Option, error) {
+	var opts []libp2p.Option
+	if len(cfg.ListenAddrs) > 0 {
+		opts = append(opts, libp2p.ListenAddrs(cfg.ListenAddrs...))
+	}
+	for _, name := range cfg.Transports {
+		t, ok := hostTransports[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown transport %q", name)
+		}
+		if cfg.PSK != nil && !privateNetworkTransports[name] {
+			return nil, fmt.Errorf("the %s transport cannot be used in a private network", name)
+		}
+		opts = append(opts, t)
+	}
+	if len(cfg.Security) > 0 {
+		secIDs, err := cfg.securityIDs()
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range secIDs {
+			if id == tls.ID {
+				opts = append(opts, libp2p.Security(tls.ID, tls.New))
+			} else {
+				opts = append(opts, libp2p.Security(noise.ID, noise.New))
+			}
+		}
+	}
+	if len(cfg.Muxers) > 0 {
+		muxers, err := cfg.muxers()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range muxers {
+			opts = append(opts, libp2p.Muxer(string(m.ID), m.Muxer))
+		}
+	}
+	if cfg.UserAgent != "" {
+		opts = append(opts, libp2p.UserAgent(cfg.UserAgent))
+	}
+	for _, r := range cfg.Relays {
+		if len(r.Addrs) == 0 {
+			return nil, fmt.Errorf("no address for the relay %s", r.ID)
+		}
+	}
+	if cfg.PSK != nil {
+		// libp2p only enables the transports that support private networks when none are picked
+		opts = append(opts, libp2p.PrivateNetwork(cfg.PSK))
+	}
+	return opts, nil
+}
+
+// identity returns the private key of the hosts, loading or creating IdentityFile the first time it is needed, or nil for a random identity
+func (cfg HostConfig) identity() (crypto.PrivKey, error) {
+	if cfg.PrivateKey != nil || cfg.IdentityFile == "" {
+		return cfg.PrivateKey, nil
+	}
+	loadedIdentity.Lock()
+	defer loadedIdentity.Unlock()
+	if loadedIdentity.key == nil || loadedIdentity.path != cfg.IdentityFile {
+		k, err := LoadOrCreateIdentity(cfg.IdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		loadedIdentity.path, loadedIdentity.key = cfg.IdentityFile, k
+	}
+	return loadedIdentity.key, nil
+}
+
+// securityIDs returns the security protocols to use in order of preference, libp2p's default order when none were picked
+func (cfg HostConfig) securityIDs() ([]protocol.ID, error) {
+	if len(cfg.Security) == 0 {
+		return []protocol.ID{tls.ID, noise.ID}, nil
+	}
+	var ids []protocol.ID
+	for _, name := range cfg.Security {
+		id, ok := hostSecurity[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown security protocol %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// muxers returns the stream multiplexers to use in order of preference, libp2p's default when none were picked
+func (cfg HostConfig) muxers() ([]tptu.StreamMuxer, error) {
+	if len(cfg.Muxers) == 0 {
+		return []tptu.StreamMuxer{hostMuxers["yamux"]}, nil
+	}
+	var muxers []tptu.StreamMuxer
+	for _, name := range cfg.Muxers {
+		m, ok := hostMuxers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown muxer %q", name)
+		}
+		muxers = append(muxers, m)
+	}
+	return muxers, nil
+}
+
+// transportEnabled reports whether hosts use the named transport
+func (cfg HostConfig) transportEnabled(name string) bool {
+	return len(cfg.Transports) == 0 || slices.Contains(cfg.Transports, name)
+}
+
+// LoadOrCreateIdentity reads a private key from the file, or generates an Ed25519 key and saves it there if the file does not exist.
+// The file holds the protobuf encoded key, either as is or base64 encoded like the PrivKey of a Kubo config.
+func LoadOrCreateIdentity(path string) (crypto.PrivKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		k, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		b, err := crypto.MarshalPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, b, 0o600); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if k, err := crypto.UnmarshalPrivateKey(data); err == nil {
+		return k, nil
+	}
+	b, err := crypto.ConfigDecodeKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s does not hold a private key", path)
+	}
+	return crypto.UnmarshalPrivateKey(b)
+}
+
+// LoadSwarmKey reads the pre-shared key of a private network from a swarm.key file, as used by Kubo and IPFS Cluster
+func LoadSwarmKey(path string) (pnet.PSK, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	psk, err := pnet.DecodeV1PSK(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading the swarm key %s: %w", path, err)
+	}
+	return psk, nil
+}
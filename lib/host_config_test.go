@@ -0,0 +1,195 @@
+package vole
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/security/noise"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestSetHostConfig(t *testing.T) {
+	defer func() { _ = SetHostConfig(HostConfig{}) }()
+
+	for _, cfg := range []HostConfig{
+		{Transports: []string{"carrier-pigeon"}},
+		{Security: []string{"plaintext"}},
+		{Muxers: []string{"mplex"}},
+	} {
+		if err := SetHostConfig(cfg); err == nil {
+			t.Fatalf("expected %+v to be rejected", cfg)
+		}
+	}
+
+	key, err := LoadOrCreateIdentity(filepath.Join(t.TempDir(), "identity"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const agent = "vole-test/0.0.1"
+	err = SetHostConfig(HostConfig{
+		PrivateKey:  key,
+		ListenAddrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/0")},
+		Transports:  []string{"tcp"},
+		Security:    []string{"noise"},
+		Muxers:      []string{"yamux"},
+		UserAgent:   agent,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := libp2pHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if id, _ := peer.IDFromPrivateKey(key); h.ID() != id {
+		t.Fatalf("expected the host to be %s, got %s", id, h.ID())
+	}
+	if len(h.Addrs()) != 1 || AddrTransport(h.Addrs()[0]) != "tcp" {
+		t.Fatalf("expected a single tcp address, got %v", h.Addrs())
+	}
+
+	other, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := other.Connect(context.Background(), peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := other.Peerstore().Get(h.ID(), "AgentVersion"); v != agent {
+		t.Fatalf("expected the user agent %q, got %v", agent, v)
+	}
+
+	ids, err := hostConfig.securityIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != noise.ID {
+		t.Fatalf("expected to only use noise, got %v", ids)
+	}
+
+	// the identity file is only created once a host needs it
+	path := filepath.Join(t.TempDir(), "lazy-identity")
+	if err := SetHostConfig(HostConfig{IdentityFile: path}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected no identity file before creating a host, got %v", err)
+	}
+	lazy, err := libp2pHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lazy.Close()
+	saved, err := LoadOrCreateIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := peer.IDFromPrivateKey(saved); lazy.ID() != id {
+		t.Fatalf("expected the host to use the saved identity %s, got %s", id, lazy.ID())
+	}
+}
+
+func TestLoadOrCreateIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity")
+	created, err := LoadOrCreateIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadOrCreateIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created.Equals(loaded) {
+		t.Fatal("expected to load the key that was created")
+	}
+
+	// the PrivKey of a Kubo config
+	b, err := crypto.MarshalPrivateKey(created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(crypto.ConfigEncodeKey(b)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = LoadOrCreateIdentity(path); err != nil || !created.Equals(loaded) {
+		t.Fatalf("expected to load the base64 encoded key, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOrCreateIdentity(path); err == nil {
+		t.Fatal("expected loading garbage to fail")
+	}
+}
+
+func TestPrivateNetwork(t *testing.T) {
+	defer func() { _ = SetHostConfig(HostConfig{}) }()
+
+	path := filepath.Join(t.TempDir(), "swarm.key")
+	key := "/key/swarm/psk/1.0.0/\n/base16/\n" + strings.Repeat("0123456789abcdef", 4) + "\n"
+	if err := os.WriteFile(path, []byte(key), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	psk, err := LoadSwarmKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetHostConfig(HostConfig{PSK: psk, Transports: []string{"quic"}}); err == nil {
+		t.Fatal("expected quic to be rejected in a private network")
+	}
+	err = SetHostConfig(HostConfig{PSK: psk, ListenAddrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/0")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := libp2pHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	ai := &peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}
+
+	public, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer public.Close()
+	if err := public.Connect(context.Background(), *ai); err == nil {
+		t.Fatal("expected a peer outside the private network to fail to connect")
+	}
+
+	member, err := libp2pHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer member.Close()
+	if err := member.Connect(context.Background(), *ai); err != nil {
+		t.Fatal(err)
+	}
+
+	var phases []*ConnectPhases
+	MeasureConnectPhases(context.Background(), ai, 10*time.Second, func(res *ConnectPhases) { phases = append(phases, res) })
+	if len(phases) != 1 || phases[0].Error != nil {
+		t.Fatalf("expected to time the connection in the private network, got %+v", phases)
+	}
+
+	if err := os.WriteFile(path, []byte("not a swarm key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSwarmKey(path); err == nil {
+		t.Fatal("expected loading garbage to fail")
+	}
+}
@@ -2,84 +2,351 @@ package vole
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"sort"
+	"sync"
+	"time"
 
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/core/protocol"
-	"github.com/libp2p/go-libp2p/core/sec"
-	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+	identifypb "github.com/libp2p/go-libp2p/p2p/protocol/identify/pb"
+	"github.com/libp2p/go-msgio/pbio"
 	"github.com/multiformats/go-multiaddr"
+	"google.golang.org/protobuf/proto"
 )
 
 type IdentifyInfo struct {
 	PeerId          peer.ID
 	ProtocolVersion string
 	AgentVersion    string
-	Addresses       []multiaddr.Multiaddr
-	Protocols       []protocol.ID
+	// Addresses are all the addresses our peerstore has for the peer, mixing the ones it advertised with the one we dialed
+	Addresses []multiaddr.Multiaddr
+	Protocols []protocol.ID
+	// ListenAddrs are the addresses the peer advertised in its identify message.
+	// When MessageError is set they are the addresses of the peerstore instead, which also hold the address we dialed.
+	ListenAddrs []ClassifiedAddr
+	// ConnectedAddr is the remote address of the connection identify ran over, or of a live connection to the peer when MessageError is set
+	ConnectedAddr *ClassifiedAddr
+	// ObservedAddr is the address the peer reported seeing our connection come from
+	ObservedAddr *ClassifiedAddr
+	// PublicKeyType is the type of the peer's identity key, e.g. Ed25519
+	PublicKeyType string
+	// PublicKey is the protobuf encoded identity key the peer sent
+	PublicKey []byte
+	// SignedPeerRecord is the serialized signed envelope containing the peer's record, if the peer sent one
+	SignedPeerRecord []byte
+	// PeerRecord is the decoded SignedPeerRecord
+	PeerRecord *PeerRecordInfo
+	// MessageError is why the identify message could not be requested again, which leaves out
+	// the parts of it the peerstore does not keep: the observed address, the public key and the peer record
+	MessageError error
+	// PushUpdates is how many identify-push messages arrived after the initial identify and were applied to the info.
+	// It only counts the pushes received before the info is returned, which for a single identify is usually none.
+	PushUpdates int
+	// ProtocolProbes is only set when identifying with IdentifyProbeProtocols
+	ProtocolProbes []*ProtocolProbe
 }
 
-func IdentifyRequest(ctx context.Context, maStr string, allowUnknownPeer bool) (*IdentifyInfo, error) {
-	usingBogusPeerID := false
+func (o *IdentifyInfo) MarshalJSON() ([]byte, error) {
+	type identifyInfo IdentifyInfo
+	var errorMsg *string
+	if o.MessageError != nil {
+		m := o.MessageError.Error()
+		errorMsg = &m
+	}
+	anon := struct {
+		*identifyInfo
+		MessageError *string
+	}{
+		identifyInfo: (*identifyInfo)(o),
+		MessageError: errorMsg,
+	}
+	return json.Marshal(anon)
+}
 
-	ai, err := peer.AddrInfoFromString(maStr)
+var _ json.Marshaler = (*IdentifyInfo)(nil)
+
+// IdentifyOption configures identify requests
+type IdentifyOption func(*identifyConfig)
+
+type identifyConfig struct {
+	probe          bool
+	probeProtocols []protocol.ID
+}
+
+// IdentifyProbeProtocols tries to negotiate every protocol the peer advertised, as well as the extra ones, to find out which it actually speaks
+func IdentifyProbeProtocols(extra ...protocol.ID) IdentifyOption {
+	return func(cfg *identifyConfig) {
+		cfg.probe = true
+		cfg.probeProtocols = extra
+	}
+}
+
+func IdentifyRequest(ctx context.Context, maStr string, allowUnknownPeer bool, opts ...IdentifyOption) (*IdentifyInfo, error) {
+	h, err := libp2pHost()
 	if err != nil {
-		if !allowUnknownPeer {
-			return nil, err
-		}
-		ma, err := multiaddr.NewMultiaddr(maStr)
-		if err != nil {
-			return nil, err
-		}
+		return nil, err
+	}
+	defer h.Close()
 
-		bogusPeerId, err := peer.Decode("QmadAdJ3f63JyNs65X7HHzqDwV53ynvCcKtNFvdNaz3nhk")
-		if err != nil {
-			panic("the hard coded bogus peerID is invalid")
-		}
-		usingBogusPeerID = true
-		ai = &peer.AddrInfo{
-			ID:    bogusPeerId,
-			Addrs: []multiaddr.Multiaddr{ma},
-		}
+	id, err := newIdentifier(h, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer id.close()
+
+	return id.identify(ctx, maStr, allowUnknownPeer)
+}
+
+// IdentifyResult is the outcome of identifying one of the peers passed to IdentifyRequests
+type IdentifyResult struct {
+	Addr     string
+	Info     *IdentifyInfo
+	Duration time.Duration
+	Error    error
+}
+
+func (o *IdentifyResult) MarshalJSON() ([]byte, error) {
+	var errorMsg *string
+	if o.Error != nil {
+		m := o.Error.Error()
+		errorMsg = &m
+	}
+	anon := struct {
+		Addr     string
+		Info     *IdentifyInfo
+		Duration string
+		Error    *string
+	}{
+		Addr:     o.Addr,
+		Info:     o.Info,
+		Duration: o.Duration.String(),
+		Error:    errorMsg,
+	}
+	return json.Marshal(anon)
+}
+
+var _ json.Marshaler = (*IdentifyResult)(nil)
+
+// IdentifyRequests identifies each of the peers using a single libp2p host, running up to concurrency requests at a time.
+// Each peer is given at most timeout and is disconnected from once identified.
+// onResult is called as each request finishes, never concurrently.
+func IdentifyRequests(ctx context.Context, maStrs []string, allowUnknownPeer bool, concurrency int, timeout time.Duration, onResult func(*IdentifyResult), opts ...IdentifyOption) error {
+	if concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got %d", concurrency)
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("timeout must be positive, got %s", timeout)
 	}
 
 	h, err := libp2pHost()
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	id, err := newIdentifier(h, opts...)
+	if err != nil {
+		return err
+	}
+	defer id.close()
+
+	var resMu sync.Mutex
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, maStr := range maStrs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func(maStr string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			tctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := time.Now()
+			info, err := id.identify(tctx, maStr, allowUnknownPeer)
+			res := &IdentifyResult{Addr: maStr, Info: info, Duration: time.Since(start), Error: err}
+			if info != nil {
+				_ = h.Network().ClosePeer(info.PeerId)
+			}
+
+			resMu.Lock()
+			defer resMu.Unlock()
+			onResult(res)
+		}(maStr)
+	}
+	wg.Wait()
+	return nil
+}
+
+// identifier runs identify requests from a host, keeping track of the identify-push messages each peer sends
+type identifier struct {
+	h   host.Host
+	sub event.Subscription
+	cfg identifyConfig
+
+	mu           sync.Mutex
+	identifyMsgs map[peer.ID]int
+
+	// the bogus peer ID used to learn the ID of unknown peers can only be dialed at one address at a time
+	unknownPeerMu sync.Mutex
+}
+
+func newIdentifier(h host.Host, opts ...IdentifyOption) (*identifier, error) {
+	var cfg identifyConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	// subscribe before connecting, the first identify happens as part of the connection
+	sub, err := h.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted), eventbus.BufSize(16))
 	if err != nil {
 		return nil, err
 	}
+	id := &identifier{h: h, sub: sub, cfg: cfg, identifyMsgs: make(map[peer.ID]int)}
+	go func() {
+		for e := range sub.Out() {
+			id.mu.Lock()
+			id.identifyMsgs[e.(event.EvtPeerIdentificationCompleted).Peer]++
+			id.mu.Unlock()
+		}
+	}()
+	return id, nil
+}
+
+func (id *identifier) close() {
+	_ = id.sub.Close()
+}
+
+// pushes returns how many identify messages the peer sent after the initial one
+func (id *identifier) pushes(p peer.ID) int {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+	if n := id.identifyMsgs[p]; n > 1 {
+		return n - 1
+	}
+	return 0
+}
 
-	if err := h.Connect(ctx, *ai); err != nil {
-		if !usingBogusPeerID {
+func (id *identifier) identify(ctx context.Context, maStr string, allowUnknownPeer bool) (*IdentifyInfo, error) {
+	h := id.h
+	ai, err := peer.AddrInfoFromString(maStr)
+	if err != nil {
+		if !allowUnknownPeer {
 			return nil, err
 		}
-		newPeerId, err := extractPeerIDFromError(err)
+		ma, err := multiaddr.NewMultiaddr(maStr)
 		if err != nil {
 			return nil, err
 		}
-		ai.ID = newPeerId
-		if err := h.Connect(ctx, *ai); err != nil {
+		if ai, err = id.discoverPeer(ctx, ma); err != nil {
 			return nil, err
 		}
+	} else if err := h.Connect(ctx, *ai); err != nil {
+		return nil, err
 	}
 
-	return extractIdentifyInfo(h.Peerstore(), ai.ID)
+	info, err := extractIdentifyInfo(h.Peerstore(), ai.ID)
+	if err != nil {
+		return nil, err
+	}
+	if msg, remote, err := requestIdentifyMessage(ctx, h, ai.ID); err != nil {
+		// the peer was identified, only the details are missing
+		info.MessageError = err
+		if conns := h.Network().ConnsToPeer(ai.ID); len(conns) > 0 {
+			connected := ClassifyAddr(conns[0].RemoteMultiaddr())
+			info.ConnectedAddr = &connected
+		}
+		info.ListenAddrs = ClassifyAddrs(h.Peerstore().Addrs(ai.ID))
+	} else {
+		connected := ClassifyAddr(remote)
+		info.ConnectedAddr = &connected
+		addIdentifyMessage(info, msg)
+	}
+	info.PushUpdates = id.pushes(ai.ID)
+	if id.cfg.probe {
+		info.ProtocolProbes = probeProtocols(ctx, h, ai.ID, info.Protocols, id.cfg.probeProtocols)
+	}
+	return info, nil
 }
 
-func extractPeerIDFromError(inputErr error) (peer.ID, error) {
-	var dialErr *swarm.DialError
-	if !errors.As(inputErr, &dialErr) {
-		return "", inputErr
+// requestIdentifyMessage asks the peer for its identify message again to get at the parts the identify service does not keep,
+// such as signed peer records that failed to verify. It also returns the remote address of the connection the message was received on.
+func requestIdentifyMessage(ctx context.Context, h host.Host, p peer.ID) (*identifypb.Identify, multiaddr.Multiaddr, error) {
+	s, err := h.NewStream(ctx, p, identify.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	remote := s.Conn().RemoteMultiaddr()
+	defer func() { _ = s.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.SetDeadline(deadline)
+	}
+
+	// large messages are split in several parts that have to be merged
+	const maxParts = 10
+	r := pbio.NewDelimitedReader(s, network.MessageSizeMax)
+	msg := &identifypb.Identify{}
+	for i := 0; i < maxParts; i++ {
+		part := &identifypb.Identify{}
+		switch err := r.ReadMsg(part); err {
+		case io.EOF:
+			return msg, remote, nil
+		case nil:
+			proto.Merge(msg, part)
+		default:
+			_ = s.Reset()
+			return nil, nil, err
+		}
 	}
-	innerErr := dialErr.DialErrors[0].Cause
+	_ = s.Reset()
+	return nil, nil, errors.New("identify message has too many parts")
+}
 
-	var peerIDMismatchErr sec.ErrPeerIDMismatch
-	if errors.As(innerErr, &peerIDMismatchErr) {
-		return peerIDMismatchErr.Actual, nil
+// addIdentifyMessage fills in the parts of the identify message that are not kept in the peerstore.
+// Like the identify service it carries on when the signed peer record cannot be decoded, marking it malformed.
+func addIdentifyMessage(info *IdentifyInfo, msg *identifypb.Identify) {
+	if obs, err := multiaddr.NewMultiaddrBytes(msg.GetObservedAddr()); err == nil {
+		observed := ClassifyAddr(obs)
+		info.ObservedAddr = &observed
+	}
+	if pk := msg.GetPublicKey(); len(pk) > 0 {
+		info.PublicKey = pk
+		if k, err := crypto.UnmarshalPublicKey(pk); err == nil {
+			info.PublicKeyType = k.Type().String()
+		}
 	}
 
-	return "", inputErr
+	var listenAddrs []multiaddr.Multiaddr
+	for _, b := range msg.GetListenAddrs() {
+		if a, err := multiaddr.NewMultiaddrBytes(b); err == nil {
+			listenAddrs = append(listenAddrs, a)
+		}
+	}
+	info.ListenAddrs = ClassifyAddrs(listenAddrs)
+	if env := msg.GetSignedPeerRecord(); len(env) > 0 {
+		info.SignedPeerRecord = env
+		rec, err := DecodeSignedPeerRecord(info.PeerId, env, listenAddrs)
+		if err != nil {
+			rec = &PeerRecordInfo{Malformed: true, Error: err}
+		}
+		info.PeerRecord = rec
+	}
 }
 
 func extractIdentifyInfo(ps peerstore.Peerstore, p peer.ID) (*IdentifyInfo, error) {
@@ -102,6 +369,10 @@ func extractIdentifyInfo(ps peerstore.Peerstore, p peer.ID) (*IdentifyInfo, erro
 	info.Protocols = append(info.Protocols, protocols...)
 	sort.Slice(info.Protocols, func(i, j int) bool { return info.Protocols[i] < info.Protocols[j] })
 
+	if pk := ps.PubKey(p); pk != nil {
+		info.PublicKeyType = pk.Type().String()
+	}
+
 	if v, err := ps.Get(p, "ProtocolVersion"); err == nil {
 		if vs, ok := v.(string); ok {
 			info.ProtocolVersion = vs
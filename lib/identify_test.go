@@ -2,18 +2,32 @@ package vole
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	gotls "crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+	identifypb "github.com/libp2p/go-libp2p/p2p/protocol/identify/pb"
 	"github.com/libp2p/go-libp2p/p2p/security/noise"
 	tls "github.com/libp2p/go-libp2p/p2p/security/tls"
 	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 	libp2pwebrtc "github.com/libp2p/go-libp2p/p2p/transport/webrtc"
 	ws "github.com/libp2p/go-libp2p/p2p/transport/websocket"
+	"github.com/libp2p/go-msgio/pbio"
 	"github.com/multiformats/go-multiaddr"
 )
 
@@ -158,3 +172,217 @@ func TestDiscoverPeerID(t *testing.T) {
 		runTest(t, h)
 	})
 }
+
+func TestIdentifyRequestMessageDetails(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	hostAddrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := IdentifyRequest(ctx, hostAddrs[0].String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.PublicKeyType != "Ed25519" {
+		t.Fatalf("expected an Ed25519 key, got %q", resp.PublicKeyType)
+	}
+	if resp.ObservedAddr == nil || resp.ObservedAddr.Scope != AddrScopeLoopback {
+		t.Fatalf("expected a loopback observed address, got %v", resp.ObservedAddr)
+	}
+	if resp.ConnectedAddr == nil || !resp.ConnectedAddr.Addr.Equal(h.Addrs()[0]) || resp.ConnectedAddr.Transport != "tcp" {
+		t.Fatalf("expected to be connected to %s over tcp, got %v", h.Addrs()[0], resp.ConnectedAddr)
+	}
+	if len(resp.ListenAddrs) != len(h.Addrs()) {
+		t.Fatalf("expected %d listen addresses, got %d", len(h.Addrs()), len(resp.ListenAddrs))
+	}
+	if len(resp.SignedPeerRecord) == 0 {
+		t.Fatal("expected a signed peer record")
+	}
+	if resp.PeerRecord == nil || !resp.PeerRecord.SignatureValid {
+		t.Fatal("expected the signed peer record to verify")
+	}
+	if len(resp.PublicKey) == 0 {
+		t.Fatal("expected a public key")
+	}
+	if resp.PushUpdates != 0 {
+		t.Fatalf("expected no identify-push updates, got %d", resp.PushUpdates)
+	}
+}
+
+func TestIdentifyRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var maStrs []string
+	expected := make(map[string]peer.ID)
+	for i := 0; i < 3; i++ {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+		// identify the last peer without knowing its ID
+		ma := h.Addrs()[0].String()
+		if i < 2 {
+			ma += "/p2p/" + h.ID().String()
+		}
+		maStrs = append(maStrs, ma)
+		expected[ma] = h.ID()
+	}
+	const badAddr = "/ip4/127.0.0.1/tcp/1/p2p/12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN"
+	maStrs = append(maStrs, badAddr)
+
+	results := make(map[string]*IdentifyResult)
+	err := IdentifyRequests(ctx, maStrs, true, 2, time.Second*10, func(r *IdentifyResult) {
+		results[r.Addr] = r
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(maStrs) {
+		t.Fatalf("expected %d results, got %d", len(maStrs), len(results))
+	}
+	for ma, p := range expected {
+		r := results[ma]
+		if r.Error != nil {
+			t.Fatalf("%s: %v", ma, r.Error)
+		}
+		if r.Info.PeerId != p {
+			t.Fatalf("%s: expected peer %s, got %s", ma, p, r.Info.PeerId)
+		}
+	}
+	if results[badAddr].Error == nil {
+		t.Fatal("expected identifying an unreachable peer to fail")
+	}
+
+	if err := IdentifyRequests(ctx, maStrs, true, 0, time.Second, func(*IdentifyResult) {}); err == nil {
+		t.Fatal("expected a concurrency of 0 to be rejected")
+	}
+	if err := IdentifyRequests(ctx, maStrs, true, 1, 0, func(*IdentifyResult) {}); err == nil {
+		t.Fatal("expected a timeout of 0 to be rejected")
+	}
+}
+
+func TestDiscoverPeerErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	for _, ma := range []string{
+		"/ip4/127.0.0.1/tcp/4001/p2p/12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN/p2p-circuit",
+		"/ip4/127.0.0.1/tcp/1",
+	} {
+		_, err := IdentifyRequest(ctx, ma, true)
+		var dErr *PeerDiscoveryError
+		if !errors.As(err, &dErr) {
+			t.Fatalf("%s: expected a peer discovery error, got %v", ma, err)
+		}
+		if dErr.Addr.String() != ma {
+			t.Fatalf("expected the error to be about %s, got %s", ma, dErr.Addr)
+		}
+	}
+}
+
+func TestIdentifyRequestBadMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	hostAddrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// answer identify with a record that cannot be decoded, and reset the streams after the first one when resetLater is set
+	var requests atomic.Int32
+	var resetLater atomic.Bool
+	h.SetStreamHandler(identify.ID, func(s network.Stream) {
+		if requests.Add(1) > 1 && resetLater.Load() {
+			_ = s.Reset()
+			return
+		}
+		defer s.Close()
+		msg := &identifypb.Identify{
+			ListenAddrs:      [][]byte{h.Addrs()[0].Bytes()},
+			Protocols:        []string{"/test/1.0.0"},
+			SignedPeerRecord: []byte("not an envelope"),
+		}
+		_ = pbio.NewDelimitedWriter(s).WriteMsg(msg)
+	})
+
+	resp, err := IdentifyRequest(ctx, hostAddrs[0].String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.PeerRecord == nil || !resp.PeerRecord.Malformed || resp.PeerRecord.Error == nil {
+		t.Fatalf("expected the signed peer record to be reported as malformed, got %+v", resp.PeerRecord)
+	}
+	if len(resp.ListenAddrs) != 1 {
+		t.Fatalf("expected the rest of the message, got listen addresses %v", resp.ListenAddrs)
+	}
+
+	requests.Store(0)
+	resetLater.Store(true)
+	resp, err = IdentifyRequest(ctx, hostAddrs[0].String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.MessageError == nil || resp.PeerId != h.ID() {
+		t.Fatalf("expected the peer to be identified without the message details, got %+v", resp)
+	}
+	if resp.ConnectedAddr == nil || len(resp.ListenAddrs) == 0 {
+		t.Fatalf("expected the addresses to come from the connection and the peerstore, got %v and %v", resp.ConnectedAddr, resp.ListenAddrs)
+	}
+}
+
+func TestDiscoverPeerWSS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConf := &gotls.Config{Certificates: []gotls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+
+	h, err := libp2p.New(
+		libp2p.Transport(ws.New, ws.WithTLSConfig(serverConf)),
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0/wss"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// the self-signed certificate cannot be verified, which has to be told apart from a failed libp2p handshake
+	_, err = IdentifyRequest(ctx, h.Addrs()[0].String(), true)
+	var dErr *PeerDiscoveryError
+	if !errors.As(err, &dErr) {
+		t.Fatalf("expected a peer discovery error, got %v", err)
+	}
+	if !strings.Contains(dErr.Reason, "certificate") {
+		t.Fatalf("expected the certificate to be blamed, got %q", dErr.Reason)
+	}
+}
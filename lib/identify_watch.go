@@ -0,0 +1,201 @@
+package vole
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// IdentifyUpdateKind says what caused an IdentifyUpdate
+type IdentifyUpdateKind string
+
+const (
+	// IdentifyUpdateIdentified is the first update, listing everything the peer advertised as added
+	IdentifyUpdateIdentified IdentifyUpdateKind = "identified"
+	// IdentifyUpdateChanged is sent when an identify-push, or the identify after reconnecting, changed what the peer advertises
+	IdentifyUpdateChanged      IdentifyUpdateKind = "changed"
+	IdentifyUpdateDisconnected IdentifyUpdateKind = "disconnected"
+	IdentifyUpdateReconnected  IdentifyUpdateKind = "reconnected"
+)
+
+// IdentifyUpdate describes how what a peer advertises over identify changed
+type IdentifyUpdate struct {
+	Time               time.Time
+	Peer               peer.ID
+	Kind               IdentifyUpdateKind
+	ProtocolsAdded     []protocol.ID
+	ProtocolsRemoved   []protocol.ID
+	ListenAddrsAdded   []multiaddr.Multiaddr
+	ListenAddrsRemoved []multiaddr.Multiaddr
+	// AgentVersion and ProtocolVersion are only set when they changed
+	AgentVersion    *string
+	ProtocolVersion *string
+}
+
+// Empty reports whether the update carries no changes
+func (u *IdentifyUpdate) Empty() bool {
+	return len(u.ProtocolsAdded) == 0 && len(u.ProtocolsRemoved) == 0 &&
+		len(u.ListenAddrsAdded) == 0 && len(u.ListenAddrsRemoved) == 0 &&
+		u.AgentVersion == nil && u.ProtocolVersion == nil
+}
+
+func (u *IdentifyUpdate) MarshalJSON() ([]byte, error) {
+	type identifyUpdate IdentifyUpdate
+	anon := struct {
+		*identifyUpdate
+		Time string
+	}{
+		identifyUpdate: (*identifyUpdate)(u),
+		Time:           u.Time.UTC().Format(time.RFC3339Nano),
+	}
+	return json.Marshal(anon)
+}
+
+var _ json.Marshaler = (*IdentifyUpdate)(nil)
+
+// identifyState is what a peer advertised in its latest identify message
+type identifyState struct {
+	protocols       []protocol.ID
+	listenAddrs     []multiaddr.Multiaddr
+	agentVersion    string
+	protocolVersion string
+}
+
+// WatchIdentify identifies the peer and stays connected, calling onUpdate with what changed whenever the peer sends a new identify message.
+// If the peer disconnects it is redialed every reconnectInterval. It runs until the context is done.
+func WatchIdentify(ctx context.Context, maStr string, allowUnknownPeer bool, reconnectInterval time.Duration, onUpdate func(*IdentifyUpdate)) error {
+	h, err := libp2pHost()
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	id, err := newIdentifier(h)
+	if err != nil {
+		return err
+	}
+	defer id.close()
+
+	// subscribe before identifying so no change can be missed, the events of the initial identify are ignored as they change nothing
+	sub, err := h.EventBus().Subscribe([]any{new(event.EvtPeerIdentificationCompleted), new(event.EvtPeerConnectednessChanged)}, eventbus.BufSize(16))
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	info, err := id.identify(ctx, maStr, allowUnknownPeer)
+	if err != nil {
+		return err
+	}
+	p := info.PeerId
+	redial := peer.AddrInfo{ID: p, Addrs: h.Peerstore().Addrs(p)}
+	if info.ConnectedAddr != nil {
+		redial.Addrs = []multiaddr.Multiaddr{info.ConnectedAddr.Addr}
+	}
+
+	state := identifyState{
+		protocols:       info.Protocols,
+		agentVersion:    info.AgentVersion,
+		protocolVersion: info.ProtocolVersion,
+	}
+	for _, a := range info.ListenAddrs {
+		state.listenAddrs = append(state.listenAddrs, a.Addr)
+	}
+	// without the identify message the listen addresses came from the peerstore, so take the advertised ones from the initial identify event
+	seedListenAddrs := info.MessageError != nil
+	first := diffIdentifyState(identifyState{}, state)
+	first.Time, first.Peer, first.Kind = time.Now(), p, IdentifyUpdateIdentified
+	onUpdate(first)
+
+	connected := true
+	ticker := time.NewTicker(reconnectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case e := <-sub.Out():
+			switch evt := e.(type) {
+			case event.EvtPeerIdentificationCompleted:
+				if evt.Peer != p {
+					continue
+				}
+				if seedListenAddrs {
+					state.listenAddrs = evt.ListenAddrs
+					seedListenAddrs = false
+				}
+				cur := identifyState{
+					protocols:       evt.Protocols,
+					listenAddrs:     evt.ListenAddrs,
+					agentVersion:    evt.AgentVersion,
+					protocolVersion: evt.ProtocolVersion,
+				}
+				u := diffIdentifyState(state, cur)
+				state = cur
+				if !u.Empty() {
+					u.Time, u.Peer, u.Kind = time.Now(), p, IdentifyUpdateChanged
+					onUpdate(u)
+				}
+			case event.EvtPeerConnectednessChanged:
+				if evt.Peer != p {
+					continue
+				}
+				wasConnected := connected
+				connected = evt.Connectedness == network.Connected
+				switch {
+				case wasConnected && !connected:
+					onUpdate(&IdentifyUpdate{Time: time.Now(), Peer: p, Kind: IdentifyUpdateDisconnected})
+				case !wasConnected && connected:
+					onUpdate(&IdentifyUpdate{Time: time.Now(), Peer: p, Kind: IdentifyUpdateReconnected})
+				}
+			}
+		case <-ticker.C:
+			if connected {
+				continue
+			}
+			// the outcome is reported through the connectedness events
+			go func() {
+				tctx, cancel := context.WithTimeout(ctx, reconnectInterval)
+				defer cancel()
+				_ = h.Connect(tctx, redial)
+			}()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func diffIdentifyState(prev, cur identifyState) *IdentifyUpdate {
+	u := &IdentifyUpdate{}
+	u.ProtocolsAdded = protocolsMissingFrom(cur.protocols, prev.protocols)
+	u.ProtocolsRemoved = protocolsMissingFrom(prev.protocols, cur.protocols)
+	u.ListenAddrsAdded = addrsMissingFrom(cur.listenAddrs, prev.listenAddrs)
+	u.ListenAddrsRemoved = addrsMissingFrom(prev.listenAddrs, cur.listenAddrs)
+	if cur.agentVersion != prev.agentVersion {
+		u.AgentVersion = &cur.agentVersion
+	}
+	if cur.protocolVersion != prev.protocolVersion {
+		u.ProtocolVersion = &cur.protocolVersion
+	}
+	return u
+}
+
+// protocolsMissingFrom returns the protocols in protos that are not in other
+func protocolsMissingFrom(protos, other []protocol.ID) []protocol.ID {
+	known := make(map[protocol.ID]struct{}, len(other))
+	for _, p := range other {
+		known[p] = struct{}{}
+	}
+	var missing []protocol.ID
+	for _, p := range protos {
+		if _, ok := known[p]; !ok {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
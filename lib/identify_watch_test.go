@@ -0,0 +1,140 @@
+package vole
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+	identifypb "github.com/libp2p/go-libp2p/p2p/protocol/identify/pb"
+	"github.com/libp2p/go-msgio/pbio"
+)
+
+func TestWatchIdentify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	hostAddrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates := make(chan *IdentifyUpdate, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- WatchIdentify(ctx, hostAddrs[0].String(), false, time.Second, func(u *IdentifyUpdate) { updates <- u })
+	}()
+
+	next := func() *IdentifyUpdate {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case err := <-done:
+			t.Fatalf("watch stopped: %v", err)
+		case <-time.After(time.Second * 10):
+			t.Fatal("timed out waiting for an update")
+		}
+		return nil
+	}
+
+	u := next()
+	if u.Kind != IdentifyUpdateIdentified || len(u.ProtocolsAdded) == 0 || len(u.ListenAddrsAdded) != 1 {
+		t.Fatalf("unexpected initial update %+v", u)
+	}
+
+	const newProto = "/test/new/1.0.0"
+	h.SetStreamHandler(newProto, func(s network.Stream) { _ = s.Close() })
+	u = next()
+	if u.Kind != IdentifyUpdateChanged || len(u.ProtocolsAdded) != 1 || u.ProtocolsAdded[0] != newProto || len(u.ProtocolsRemoved) != 0 {
+		t.Fatalf("expected %s to be added, got %+v", newProto, u)
+	}
+
+	h.RemoveStreamHandler(newProto)
+	u = next()
+	if u.Kind != IdentifyUpdateChanged || len(u.ProtocolsRemoved) != 1 || u.ProtocolsRemoved[0] != newProto {
+		t.Fatalf("expected %s to be removed, got %+v", newProto, u)
+	}
+
+	_ = h.Close()
+	if u = next(); u.Kind != IdentifyUpdateDisconnected {
+		t.Fatalf("expected to be disconnected, got %+v", u)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected the watch to be canceled, got %v", err)
+	}
+}
+
+func TestWatchIdentifyWithoutMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	hostAddrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// answer the initial identify and reset the re-request, pushes still come from the identify service
+	var requests atomic.Int32
+	h.SetStreamHandler(identify.ID, func(s network.Stream) {
+		if requests.Add(1) > 1 {
+			_ = s.Reset()
+			return
+		}
+		defer s.Close()
+		msg := &identifypb.Identify{
+			ListenAddrs: [][]byte{h.Addrs()[0].Bytes()},
+			Protocols:   []string{"/test/1.0.0"},
+		}
+		_ = pbio.NewDelimitedWriter(s).WriteMsg(msg)
+	})
+
+	updates := make(chan *IdentifyUpdate, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- WatchIdentify(ctx, hostAddrs[0].String(), false, time.Second, func(u *IdentifyUpdate) { updates <- u })
+	}()
+	next := func() *IdentifyUpdate {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case err := <-done:
+			t.Fatalf("watch stopped: %v", err)
+		case <-time.After(time.Second * 10):
+			t.Fatal("timed out waiting for an update")
+		}
+		return nil
+	}
+
+	if u := next(); u.Kind != IdentifyUpdateIdentified || len(u.ListenAddrsAdded) == 0 {
+		t.Fatalf("unexpected initial update %+v", u)
+	}
+
+	const newProto = "/test/new/1.0.0"
+	h.SetStreamHandler(newProto, func(s network.Stream) { _ = s.Close() })
+	u := next()
+	if u.Kind != IdentifyUpdateChanged || !slices.Contains(u.ProtocolsAdded, newProto) {
+		t.Fatalf("expected %s to be added, got %+v", newProto, u)
+	}
+	if len(u.ListenAddrsAdded) != 0 || len(u.ListenAddrsRemoved) != 0 {
+		t.Fatalf("expected the listen addresses to be unchanged, got %+v", u)
+	}
+}
@@ -0,0 +1,163 @@
+package vole
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	kb "github.com/libp2p/go-libp2p-kbucket"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multihash"
+)
+
+// DhtKeyType describes how a user supplied value is turned into the bytes of a DHT key
+type DhtKeyType string
+
+const (
+	// DhtKeyCID is keyed by the multihash of the CID, as used for provider records
+	DhtKeyCID DhtKeyType = "cid"
+	// DhtKeyMultihash is keyed by the multihash itself, given in base58 or multibase
+	DhtKeyMultihash DhtKeyType = "mh"
+	// DhtKeyPeer is keyed by the peer ID, as used when looking up a peer
+	DhtKeyPeer DhtKeyType = "peer"
+	// DhtKeyIPNS is the /ipns/ record key of a name, which is a peer ID optionally prefixed by /ipns/
+	DhtKeyIPNS DhtKeyType = "ipns"
+	// DhtKeyPK is the /pk/ public key record key of a peer ID
+	DhtKeyPK DhtKeyType = "pk"
+	// DhtKeyString is keyed by the raw bytes of the string
+	DhtKeyString DhtKeyType = "str"
+	// DhtKeyMultibase is keyed by the multibase decoded bytes
+	DhtKeyMultibase DhtKeyType = "mb"
+	// DhtKeyAuto detects the type of the value, see AutoDhtKey
+	DhtKeyAuto DhtKeyType = "auto"
+)
+
+var dhtKeyTypes = []DhtKeyType{DhtKeyCID, DhtKeyMultihash, DhtKeyPeer, DhtKeyIPNS, DhtKeyPK, DhtKeyString, DhtKeyMultibase, DhtKeyAuto}
+
+// DhtKey converts the value into DHT key bytes according to the key type
+func DhtKey(typ DhtKeyType, value string) ([]byte, error) {
+	switch typ {
+	case DhtKeyCID:
+		c, err := cid.Decode(value)
+		if err != nil {
+			return nil, err
+		}
+		return c.Hash(), nil
+	case DhtKeyMultihash:
+		mh, err := multihash.FromB58String(value)
+		if err == nil {
+			return mh, nil
+		}
+		_, b, err := multibase.Decode(value)
+		if err != nil {
+			return nil, fmt.Errorf("multihash is neither base58 nor multibase encoded: %w", err)
+		}
+		if _, err := multihash.Cast(b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	case DhtKeyPeer:
+		p, err := peer.Decode(value)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(p), nil
+	case DhtKeyIPNS:
+		p, err := peer.Decode(strings.TrimPrefix(value, "/ipns/"))
+		if err != nil {
+			return nil, err
+		}
+		return []byte("/ipns/" + string(p)), nil
+	case DhtKeyPK:
+		p, err := peer.Decode(value)
+		if err != nil {
+			return nil, err
+		}
+		return []byte("/pk/" + string(p)), nil
+	case DhtKeyString:
+		return []byte(value), nil
+	case DhtKeyMultibase:
+		_, b, err := multibase.Decode(value)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case DhtKeyAuto:
+		b, _, err := AutoDhtKey(value, DhtKeyPeer)
+		return b, err
+	default:
+		return nil, fmt.Errorf("unknown key type %q", typ)
+	}
+}
+
+// AutoDhtKey detects the type of the value and converts it into DHT key bytes, returning the type that was used.
+// Values are tried as /ipns/ and /pk/ paths, CIDs other than libp2p-key ones, peer IDs, libp2p-key CIDs and multibase bytes in that order,
+// falling back to a raw string. A base58 "Qm..." value is therefore a CIDv0 rather than an RSA peer ID, which has to be given as a path or libp2p-key CID.
+// Since a bare peer ID can stand for several keys, peerKeyType picks which of DhtKeyPeer, DhtKeyIPNS or DhtKeyPK it becomes.
+func AutoDhtKey(value string, peerKeyType DhtKeyType) ([]byte, DhtKeyType, error) {
+	if strings.HasPrefix(value, "/ipns/") {
+		b, err := DhtKey(DhtKeyIPNS, value)
+		return b, DhtKeyIPNS, err
+	}
+	if p, ok := strings.CutPrefix(value, "/pk/"); ok {
+		b, err := DhtKey(DhtKeyPK, p)
+		return b, DhtKeyPK, err
+	}
+	// peer.Decode also accepts CIDv0s, which are far more likely to be content than a peer
+	c, cidErr := cid.Decode(value)
+	if cidErr == nil && c.Type() != cid.Libp2pKey {
+		b, err := DhtKey(DhtKeyCID, value)
+		return b, DhtKeyCID, err
+	}
+	if _, err := peer.Decode(value); err == nil {
+		switch peerKeyType {
+		case DhtKeyPeer, DhtKeyIPNS, DhtKeyPK:
+		default:
+			return nil, "", fmt.Errorf("peer IDs cannot be used as %q keys", peerKeyType)
+		}
+		b, err := DhtKey(peerKeyType, value)
+		return b, peerKeyType, err
+	}
+	if cidErr == nil {
+		b, err := DhtKey(DhtKeyCID, value)
+		return b, DhtKeyCID, err
+	}
+	if _, b, err := multibase.Decode(value); err == nil {
+		return b, DhtKeyMultibase, nil
+	}
+	return []byte(value), DhtKeyString, nil
+}
+
+// ParseDhtKeySpec converts a key given as "<type>:<value>" (e.g. cid:bafy...) into DHT key bytes.
+// Values without a known type prefix are treated as raw strings.
+func ParseDhtKeySpec(spec string) ([]byte, error) {
+	if typ, value, ok := strings.Cut(spec, ":"); ok {
+		for _, t := range dhtKeyTypes {
+			if DhtKeyType(typ) == t {
+				return DhtKey(t, value)
+			}
+		}
+	}
+	return DhtKey(DhtKeyString, spec)
+}
+
+// KadID returns the kademlia identifier of a DHT key, which is the SHA-256 of the key bytes
+func KadID(key []byte) []byte {
+	return kb.ConvertKey(string(key))
+}
+
+// KadDistance returns the XOR distance between the kademlia identifiers of two DHT keys
+func KadDistance(a, b []byte) []byte {
+	ida, idb := KadID(a), KadID(b)
+	d := make([]byte, len(ida))
+	for i := range ida {
+		d[i] = ida[i] ^ idb[i]
+	}
+	return d
+}
+
+// KadCommonPrefixLen returns the number of leading bits shared by the kademlia identifiers of two DHT keys
+func KadCommonPrefixLen(a, b []byte) int {
+	return kb.CommonPrefixLen(KadID(a), KadID(b))
+}
@@ -0,0 +1,108 @@
+package vole
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestParseDhtKeySpec(t *testing.T) {
+	const testCID = "bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4"
+	const testCIDv0 = "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"
+	const testPeer = "12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN"
+
+	c, err := cid.Decode(testCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := peer.Decode(testPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		spec     string
+		expected []byte
+	}{
+		{"cid:" + testCID, c.Hash()},
+		{"mh:" + c.Hash().B58String(), c.Hash()},
+		{"peer:" + testPeer, []byte(p)},
+		{"peer:" + peer.ToCid(p).String(), []byte(p)},
+		{"ipns:" + testPeer, []byte("/ipns/" + string(p))},
+		{"ipns:/ipns/" + testPeer, []byte("/ipns/" + string(p))},
+		{"pk:" + testPeer, []byte("/pk/" + string(p))},
+		{"mb:mZm9v", []byte("foo")},
+		{"str:foo", []byte("foo")},
+		{"/testval/foo:bar", []byte("/testval/foo:bar")},
+	} {
+		key, err := ParseDhtKeySpec(tc.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.spec, err)
+		}
+		if !bytes.Equal(key, tc.expected) {
+			t.Fatalf("%s: expected %x, got %x", tc.spec, tc.expected, key)
+		}
+	}
+
+	if _, err := ParseDhtKeySpec("cid:notacid"); err == nil {
+		t.Fatal("expected an invalid CID to fail")
+	}
+}
+
+func TestAutoDhtKey(t *testing.T) {
+	const testCID = "bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4"
+	const testCIDv0 = "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"
+	const testPeer = "12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN"
+
+	p, err := peer.Decode(testPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		value        string
+		peerKeyType  DhtKeyType
+		expectedType DhtKeyType
+		expected     []byte
+	}{
+		{"/ipns/" + testPeer, DhtKeyPeer, DhtKeyIPNS, []byte("/ipns/" + string(p))},
+		{"/pk/" + testPeer, DhtKeyPeer, DhtKeyPK, []byte("/pk/" + string(p))},
+		{testPeer, DhtKeyPeer, DhtKeyPeer, []byte(p)},
+		{peer.ToCid(p).String(), DhtKeyIPNS, DhtKeyIPNS, []byte("/ipns/" + string(p))},
+		{testCID, DhtKeyPeer, DhtKeyCID, cid.MustParse(testCID).Hash()},
+		// a CIDv0 also decodes as an RSA peer ID
+		{testCIDv0, DhtKeyIPNS, DhtKeyCID, cid.MustParse(testCIDv0).Hash()},
+		{"mZm9v", DhtKeyPeer, DhtKeyMultibase, []byte("foo")},
+		{"/testval/foo", DhtKeyPeer, DhtKeyString, []byte("/testval/foo")},
+	} {
+		key, typ, err := AutoDhtKey(tc.value, tc.peerKeyType)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.value, err)
+		}
+		if typ != tc.expectedType {
+			t.Fatalf("%s: expected type %q, got %q", tc.value, tc.expectedType, typ)
+		}
+		if !bytes.Equal(key, tc.expected) {
+			t.Fatalf("%s: expected %x, got %x", tc.value, tc.expected, key)
+		}
+	}
+}
+
+func TestKadDistance(t *testing.T) {
+	a, b := []byte("foo"), []byte("bar")
+
+	if cpl := KadCommonPrefixLen(a, a); cpl != 256 {
+		t.Fatalf("expected a key to share all 256 bits with itself, got %d", cpl)
+	}
+	if d := KadDistance(a, a); !bytes.Equal(d, make([]byte, 32)) {
+		t.Fatalf("expected a zero distance from a key to itself, got %x", d)
+	}
+	if !bytes.Equal(KadDistance(a, b), KadDistance(b, a)) {
+		t.Fatal("expected the distance to be symmetric")
+	}
+	if KadCommonPrefixLen(a, b) != KadCommonPrefixLen(b, a) {
+		t.Fatal("expected the common prefix length to be symmetric")
+	}
+}
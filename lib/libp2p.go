@@ -1,16 +1,61 @@
 package vole
 
 import (
+	"context"
+
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	msmux "github.com/multiformats/go-multistream"
 )
 
-func libp2pHost() (host.Host, error) {
-	h, err := libp2p.New(
-		libp2p.EnableHolePunching(),
-	)
+// libp2pHost creates a host configured by SetHostConfig, opts are applied last.
+// When relays are configured it returns once it holds a reservation on at least one of them.
+func libp2pHost(opts ...libp2p.Option) (host.Host, error) {
+	if len(hostConfig.Relays) == 0 {
+		return newHost(opts...)
+	}
+	relays := newRelayReservations(hostConfig.Relays, hostConfig.OnReservation)
+	h, err := newHost(append([]libp2p.Option{libp2p.AddrsFactory(relays.addrsFactory)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	rh, err := relays.start(h)
+	if err != nil {
+		_ = h.Close()
+		return nil, err
+	}
+	return rh, nil
+}
+
+// newHost creates a host configured by SetHostConfig without making relay reservations, for dialing a single address and timing it
+func newHost(opts ...libp2p.Option) (host.Host, error) {
+	cfgOpts, err := hostConfig.options()
 	if err != nil {
 		return nil, err
 	}
-	return h, nil
+	key, err := hostConfig.identity()
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		cfgOpts = append(cfgOpts, libp2p.Identity(key))
+	}
+	return libp2p.New(append(append([]libp2p.Option{libp2p.EnableHolePunching()}, cfgOpts...), opts...)...)
+}
+
+// negotiateProtocol opens a stream to the peer and waits for it to agree to one of the protocols.
+// Unlike host.NewStream it never skips waiting for the peer's answer when the peer claims to support the protocol.
+func negotiateProtocol(ctx context.Context, h host.Host, p peer.ID, protos ...protocol.ID) (protocol.ID, error) {
+	s, err := h.Network().NewStream(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = s.Reset() }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.SetDeadline(deadline)
+	}
+	return msmux.SelectOneOf(protos, s)
 }
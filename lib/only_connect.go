@@ -5,13 +5,38 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
 	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
 )
 
-func OnlyConnect(ctx context.Context, p *peer.AddrInfo) error {
-	h, err := libp2pHost()
+// ConnectOption configures OnlyConnect
+type ConnectOption func(*connectConfig)
+
+type connectConfig struct {
+	holePunchTimeout time.Duration
+}
+
+// ConnectHolePunchTimeout sets how long to wait for a peer connected to over a relay to hole punch a direct connection, defaults to 30 seconds
+func ConnectHolePunchTimeout(d time.Duration) ConnectOption {
+	return func(cfg *connectConfig) {
+		cfg.holePunchTimeout = d
+	}
+}
+
+// OnlyConnect connects to the peer, printing how long it took and the details of the connection, and pings it.
+// When the connection is relayed it first waits for the peer to hole punch a direct connection and prints the outcome.
+func OnlyConnect(ctx context.Context, p *peer.AddrInfo, opts ...ConnectOption) error {
+	cfg := connectConfig{holePunchTimeout: time.Second * 30}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	tracer := newHolePunchTracer()
+	h, err := libp2pHost(libp2p.EnableHolePunching(holepunch.WithTracer(tracer)))
 	if err != nil {
 		return err
 	}
@@ -19,12 +44,20 @@ func OnlyConnect(ctx context.Context, p *peer.AddrInfo) error {
 
 	start := time.Now()
 	h.Peerstore().AddAddrs(p.ID, p.Addrs, peerstore.TempAddrTTL)
-	_, err = h.Network().DialPeer(ctx, p.ID)
+	conn, err := h.Network().DialPeer(ctx, p.ID)
 	if err != nil {
 		return err
 	}
 	connectTime := time.Since(start)
 	fmt.Println("Connect took:", connectTime)
+	NewConnInfo(conn, p.Addrs).Print()
+
+	if conn.Stat().Limited || isRelayedAddr(conn.RemoteMultiaddr()) {
+		fmt.Println("Waiting for a hole punch...")
+		waitForHolePunch(ctx, h, p.ID, tracer.events, cfg.holePunchTimeout).Print()
+		// keep pinging over the relay if no direct connection came up
+		ctx = network.WithAllowLimitedConn(ctx, "connect")
+	}
 
 	pingService := ping.NewPingService(h)
 	ctx, cancel := context.WithCancel(ctx)
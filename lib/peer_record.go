@@ -0,0 +1,110 @@
+package vole
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// PeerRecordInfo is the decoded content of a signed peer record envelope
+type PeerRecordInfo struct {
+	// PeerId is the peer the record claims to be about
+	PeerId peer.ID
+	Seq    uint64
+	Addrs  []multiaddr.Multiaddr
+	// SignatureValid is set when the envelope is signed by the key of the peer the record is about
+	SignatureValid bool
+	// Error explains why the signature is not valid, or why the envelope could not be decoded
+	Error error
+	// Malformed is set when the envelope could not be decoded at all, the record is then empty
+	Malformed bool
+	// UnsignedListenAddrs are listen addresses the peer advertised that are missing from the signed record
+	UnsignedListenAddrs []multiaddr.Multiaddr
+	// UnadvertisedSignedAddrs are signed addresses the peer did not advertise as listen addresses
+	UnadvertisedSignedAddrs []multiaddr.Multiaddr
+}
+
+func (o *PeerRecordInfo) MarshalJSON() ([]byte, error) {
+	var errorMsg *string
+	if o.Error != nil {
+		m := o.Error.Error()
+		errorMsg = &m
+	}
+	type peerRecordInfo PeerRecordInfo
+	anon := struct {
+		*peerRecordInfo
+		Error *string
+	}{
+		peerRecordInfo: (*peerRecordInfo)(o),
+		Error:          errorMsg,
+	}
+	return json.Marshal(anon)
+}
+
+var _ json.Marshaler = (*PeerRecordInfo)(nil)
+
+// AddrsMatch reports whether the signed addresses and the advertised listen addresses are the same
+func (o *PeerRecordInfo) AddrsMatch() bool {
+	return len(o.UnsignedListenAddrs) == 0 && len(o.UnadvertisedSignedAddrs) == 0
+}
+
+// DecodeSignedPeerRecord decodes a serialized signed peer record envelope sent by the peer p and compares it to the listen addresses it advertised.
+// The record is decoded even when the signature does not verify so it can still be inspected, an error is only returned if it cannot be decoded at all.
+func DecodeSignedPeerRecord(p peer.ID, envelope []byte, listenAddrs []multiaddr.Multiaddr) (*PeerRecordInfo, error) {
+	rec := &peer.PeerRecord{}
+	env, err := record.ConsumeTypedEnvelope(envelope, rec)
+	if env == nil {
+		return nil, err
+	}
+	info := &PeerRecordInfo{}
+	if err != nil {
+		info.Error = err
+		// the payload is only unmarshalled once the signature has been verified
+		if err := rec.UnmarshalRecord(env.RawPayload); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal envelope payload: %w", err)
+		}
+	}
+	info.PeerId = rec.PeerID
+	info.Seq = rec.Seq
+	info.Addrs = rec.Addrs
+
+	if info.Error == nil {
+		// a valid signature only proves the record was signed by the key in the envelope
+		signer, err := peer.IDFromPublicKey(env.PublicKey)
+		switch {
+		case err != nil:
+			info.Error = err
+		case signer != rec.PeerID:
+			info.Error = fmt.Errorf("record for %s is signed by %s", rec.PeerID, signer)
+		case rec.PeerID != p:
+			info.Error = fmt.Errorf("record is for %s instead of %s", rec.PeerID, p)
+		default:
+			info.SignatureValid = true
+		}
+	}
+
+	info.UnsignedListenAddrs = addrsMissingFrom(listenAddrs, info.Addrs)
+	info.UnadvertisedSignedAddrs = addrsMissingFrom(info.Addrs, listenAddrs)
+	return info, nil
+}
+
+// addrsMissingFrom returns the addresses in addrs that are not in other
+func addrsMissingFrom(addrs, other []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	var missing []multiaddr.Multiaddr
+	for _, a := range addrs {
+		found := false
+		for _, o := range other {
+			if a.Equal(o) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, a)
+		}
+	}
+	return missing
+}
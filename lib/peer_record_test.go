@@ -0,0 +1,105 @@
+package vole
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/multiformats/go-multiaddr"
+	"google.golang.org/protobuf/proto"
+
+	recordpb "github.com/libp2p/go-libp2p/core/record/pb"
+)
+
+func TestDecodeSignedPeerRecord(t *testing.T) {
+	newKey := func() (crypto.PrivKey, peer.ID) {
+		sk, _, err := crypto.GenerateEd25519Key(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := peer.IDFromPrivateKey(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sk, p
+	}
+	sk, p := newKey()
+	otherSk, otherP := newKey()
+
+	signed := []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001"), multiaddr.StringCast("/ip4/1.2.3.4/udp/4001/quic-v1")}
+	seal := func(sk crypto.PrivKey, p peer.ID) []byte {
+		rec := peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: p, Addrs: signed})
+		env, err := record.Seal(rec, sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := env.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		listen := []multiaddr.Multiaddr{signed[0], multiaddr.StringCast("/ip4/127.0.0.1/tcp/4001")}
+		info, err := DecodeSignedPeerRecord(p, seal(sk, p), listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.SignatureValid {
+			t.Fatalf("expected a valid signature, got %v", info.Error)
+		}
+		if info.PeerId != p || info.Seq == 0 || len(info.Addrs) != len(signed) {
+			t.Fatalf("unexpected record contents %+v", info)
+		}
+		if info.AddrsMatch() {
+			t.Fatal("expected the addresses not to match")
+		}
+		if len(info.UnsignedListenAddrs) != 1 || !info.UnsignedListenAddrs[0].Equal(listen[1]) {
+			t.Fatalf("expected %s to be unsigned, got %v", listen[1], info.UnsignedListenAddrs)
+		}
+		if len(info.UnadvertisedSignedAddrs) != 1 || !info.UnadvertisedSignedAddrs[0].Equal(signed[1]) {
+			t.Fatalf("expected %s to be unadvertised, got %v", signed[1], info.UnadvertisedSignedAddrs)
+		}
+	})
+	t.Run("other peer", func(t *testing.T) {
+		info, err := DecodeSignedPeerRecord(p, seal(otherSk, otherP), signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.SignatureValid || info.Error == nil {
+			t.Fatal("expected a record for another peer to be rejected")
+		}
+		if !info.AddrsMatch() {
+			t.Fatal("expected the addresses to match")
+		}
+	})
+	t.Run("bad signature", func(t *testing.T) {
+		var env recordpb.Envelope
+		if err := proto.Unmarshal(seal(sk, p), &env); err != nil {
+			t.Fatal(err)
+		}
+		env.Signature[0] ^= 0xff
+		b, err := proto.Marshal(&env)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := DecodeSignedPeerRecord(p, b, signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.SignatureValid || info.Error == nil {
+			t.Fatal("expected the signature to be invalid")
+		}
+		if info.PeerId != p || len(info.Addrs) != len(signed) {
+			t.Fatal("expected the record to be decoded despite the invalid signature")
+		}
+	})
+	t.Run("garbage", func(t *testing.T) {
+		if _, err := DecodeSignedPeerRecord(p, []byte("not an envelope"), nil); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -4,71 +4,324 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
 	"github.com/multiformats/go-multiaddr"
 )
 
+const pingProtocol protocol.ID = "/ipfs/ping/1.0.0"
+
+// PingOption configures PingPeer
+type PingOption func(*pingConfig)
+
+type pingConfig struct {
+	count    int
+	interval time.Duration
+	timeout  time.Duration
+	onResult func(PingResult)
+}
+
+func newPingConfig(opts ...PingOption) pingConfig {
+	cfg := pingConfig{
+		count:    3,
+		interval: time.Second,
+		timeout:  time.Second * 10,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return cfg
+}
+
+// PingCount sets how many pings to send, 0 pings until the context is done. Defaults to 3.
+func PingCount(n int) PingOption {
+	return func(cfg *pingConfig) {
+		cfg.count = n
+	}
+}
+
+// PingInterval sets the time between sending two pings, defaults to 1 second
+func PingInterval(d time.Duration) PingOption {
+	return func(cfg *pingConfig) {
+		cfg.interval = d
+	}
+}
+
+// PingTimeout sets how long to wait for each reply before counting the ping as lost, defaults to 10 seconds
+func PingTimeout(d time.Duration) PingOption {
+	return func(cfg *pingConfig) {
+		cfg.timeout = d
+	}
+}
+
+// PingReporter registers a function that is called with the result of every ping
+func PingReporter(f func(PingResult)) PingOption {
+	return func(cfg *pingConfig) {
+		cfg.onResult = f
+	}
+}
+
+// PingResult is the outcome of a single ping
+type PingResult struct {
+	Seq   int
+	RTT   time.Duration
+	Error error
+}
+
+func (o PingResult) MarshalJSON() ([]byte, error) {
+	var errorMsg *string
+	if o.Error != nil {
+		m := o.Error.Error()
+		errorMsg = &m
+	}
+	var errorKind *PingErrorKind
+	if o.Error != nil {
+		k := PingErrorKindOf(o.Error)
+		errorKind = &k
+	}
+	anon := struct {
+		Seq       int
+		RTT       string
+		Error     *string
+		ErrorKind *PingErrorKind
+	}{
+		Seq:       o.Seq,
+		RTT:       o.RTT.String(),
+		Error:     errorMsg,
+		ErrorKind: errorKind,
+	}
+	return json.Marshal(anon)
+}
+
+var _ json.Marshaler = PingResult{}
+
+// PingStats summarizes a series of pings
+type PingStats struct {
+	Peer     peer.ID
+	Sent     int
+	Received int
+	// Loss is the percentage of pings that got no reply
+	Loss   float64
+	Min    time.Duration
+	Avg    time.Duration
+	Max    time.Duration
+	StdDev time.Duration
+	// Jitter is the mean difference between the RTTs of consecutive replies
+	Jitter time.Duration
+	// Conn is the connection the last ping was sent over
+	Conn *ConnInfo
+}
+
+func (o *PingStats) MarshalJSON() ([]byte, error) {
+	type pingStats PingStats
+	anon := struct {
+		*pingStats
+		Min    string
+		Avg    string
+		Max    string
+		StdDev string
+		Jitter string
+	}{
+		pingStats: (*pingStats)(o),
+		Min:       o.Min.String(),
+		Avg:       o.Avg.String(),
+		Max:       o.Max.String(),
+		StdDev:    o.StdDev.String(),
+		Jitter:    o.Jitter.String(),
+	}
+	return json.Marshal(anon)
+}
+
+var _ json.Marshaler = (*PingStats)(nil)
+
+// newPingStats computes the statistics of the RTTs of the pings that got a reply
+func newPingStats(p peer.ID, sent int, rtts []time.Duration) *PingStats {
+	s := &PingStats{Peer: p, Sent: sent, Received: len(rtts)}
+	if sent > 0 {
+		s.Loss = float64(sent-len(rtts)) / float64(sent) * 100
+	}
+	if len(rtts) == 0 {
+		return s
+	}
+
+	var sum, jitterSum time.Duration
+	s.Min = rtts[0]
+	for i, rtt := range rtts {
+		sum += rtt
+		s.Min = min(s.Min, rtt)
+		s.Max = max(s.Max, rtt)
+		if i > 0 {
+			diff := rtt - rtts[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			jitterSum += diff
+		}
+	}
+	s.Avg = sum / time.Duration(len(rtts))
+	if len(rtts) > 1 {
+		s.Jitter = jitterSum / time.Duration(len(rtts)-1)
+	}
+
+	var variance float64
+	for _, rtt := range rtts {
+		d := float64(rtt - s.Avg)
+		variance += d * d
+	}
+	s.StdDev = time.Duration(math.Sqrt(variance / float64(len(rtts))))
+	return s
+}
+
+// Ping pings the peer three times, printing how long each ping took.
+// It returns the error of the first ping that failed.
 func Ping(ctx context.Context, forceRelay bool, p *peer.AddrInfo) error {
+	var pingErr error
+	_, err := PingPeer(ctx, forceRelay, p, PingReporter(func(r PingResult) {
+		if r.Error == nil {
+			fmt.Println("Took ", r.RTT)
+		} else if pingErr == nil {
+			pingErr = r.Error
+		}
+	}))
+	if err != nil {
+		return err
+	}
+	return pingErr
+}
+
+// PingPeer connects to the peer and pings it at an interval, returning statistics about the replies.
+// Pings that fail or time out are counted as lost and the next one is sent on a fresh stream.
+// Errors, both returned and reported, are *PingError telling what failed.
+// When the context is done the statistics of the pings sent so far are returned.
+func PingPeer(ctx context.Context, forceRelay bool, p *peer.AddrInfo, opts ...PingOption) (*PingStats, error) {
+	cfg := newPingConfig(opts...)
+
 	if forceRelay {
 		// We don't want a direct connection, so set this to a high value so
 		// that we don't learn our public address
 		identify.ActivationThresh = 100
 
 		for _, addr := range p.Addrs {
-			if _, err := addr.ValueForProtocol(multiaddr.P_CIRCUIT); err != nil {
-				return fmt.Errorf("force-relay=true but peer is not using a relayed address")
+			if isRelayedAddr(addr) {
+				continue
 			}
+			if len(hostConfig.Relays) == 0 {
+				return nil, fmt.Errorf("force-relay=true but peer is not using a relayed address and no relay is configured")
+			}
+			// reach the peer through the configured relays, where it needs a reservation
+			p = &peer.AddrInfo{ID: p.ID, Addrs: circuitAddrs(hostConfig.Relays)}
+			break
 		}
 	}
 
 	h, err := libp2pHost()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer h.Close()
-	h.Connect(ctx, *p)
-
-	times := 3
+	if err := h.Connect(ctx, *p); err != nil {
+		return nil, classifyPingError(err, PingErrorDial)
+	}
 
 	if forceRelay {
 		ctx = network.WithAllowLimitedConn(ctx, "ping")
 	}
 
 	// Reimplementing ping because the default implementation may use a relayed connection instead of a direct one
-	in := [32]byte{}
-	out := [32]byte{}
-	s, err := h.NewStream(ctx, p.ID, "/ipfs/ping/1.0.0")
+	return pingStream(ctx, p.ID, p.Addrs, cfg, func(ctx context.Context) (network.Stream, error) {
+		return h.NewStream(ctx, p.ID, pingProtocol)
+	})
+}
+
+// pingStream pings the peer over the streams returned by newStream as configured, opening a fresh one after a failed ping.
+// It only fails when the first stream cannot be opened. dialedAddrs are the addresses the peer was connected to with.
+func pingStream(ctx context.Context, p peer.ID, dialedAddrs []multiaddr.Multiaddr, cfg pingConfig, newStream func(context.Context) (network.Stream, error)) (*PingStats, error) {
+	s, err := newStream(ctx)
 	if err != nil {
-		return err
+		return nil, classifyPingError(err, PingErrorDial)
 	}
-
-	for i := 0; i < times; i++ {
-		_, err := rand.Reader.Read(in[:])
-		if err != nil {
-			return err
+	defer func() {
+		if s != nil {
+			_ = s.Reset()
 		}
+	}()
 
+	var rtts []time.Duration
+	sent := 0
+	conn := s.Conn()
+	for seq := 1; ; seq++ {
 		start := time.Now()
-		s.Write(in[:])
-		n, err := s.Read(out[:])
-		if err != nil {
-			return err
+		if s == nil {
+			s, err = newStream(ctx)
+			err = classifyPingError(err, PingErrorDial)
+		}
+		if err == nil {
+			conn = s.Conn()
+			err = pingOnce(s, cfg.timeout)
 		}
-		if n != 32 {
-			return fmt.Errorf("expected 32 bytes, got %d", n)
+		if ctx.Err() != nil {
+			break
 		}
-		if !bytes.Equal(in[:], out[:]) {
-			return fmt.Errorf("expected %x, got %x", in[:], out[:])
+		sent++
+
+		res := PingResult{Seq: seq, Error: err}
+		if err == nil {
+			res.RTT = time.Since(start)
+			rtts = append(rtts, res.RTT)
+		} else if s != nil {
+			// a late reply would be mistaken for the answer to the next ping
+			_ = s.Reset()
+			s = nil
+		}
+		if cfg.onResult != nil {
+			cfg.onResult(res)
 		}
 
-		fmt.Println("Took ", time.Since(start))
-		time.Sleep(time.Second)
+		if seq == cfg.count {
+			break
+		}
+		select {
+		case <-time.After(cfg.interval - time.Since(start)):
+			continue
+		case <-ctx.Done():
+		}
+		break
 	}
 
+	stats := newPingStats(p, sent, rtts)
+	stats.Conn = NewConnInfo(conn, dialedAddrs)
+	return stats, nil
+}
+
+// pingOnce sends a single ping on the stream and waits for the reply
+func pingOnce(s network.Stream, timeout time.Duration) error {
+	in := [32]byte{}
+	out := [32]byte{}
+	if _, err := rand.Reader.Read(in[:]); err != nil {
+		return &PingError{Kind: PingErrorOther, Err: err}
+	}
+
+	_ = s.SetDeadline(time.Now().Add(timeout))
+	if n, err := s.Write(in[:]); err != nil {
+		return classifyPingError(fmt.Errorf("sent %d of %d bytes: %w", n, len(in), err), PingErrorOther)
+	}
+	if n, err := io.ReadFull(s, out[:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return &PingError{Kind: PingErrorShortRead, Err: fmt.Errorf("stream closed after %d of %d bytes of the reply", n, len(out))}
+		}
+		return classifyPingError(fmt.Errorf("received %d of %d bytes: %w", n, len(out), err), PingErrorOther)
+	}
+	if !bytes.Equal(in[:], out[:]) {
+		return &PingError{Kind: PingErrorMismatch, Err: fmt.Errorf("expected %x, got %x", in[:], out[:])}
+	}
 	return nil
 }
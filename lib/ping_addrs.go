@@ -0,0 +1,155 @@
+package vole
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	"github.com/multiformats/go-multiaddr"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+// AddrPingResult is the outcome of pinging a peer over a connection to one of its addresses
+type AddrPingResult struct {
+	Addr      multiaddr.Multiaddr
+	Transport string
+	// ConnectTime is how long it took until the connection was usable, including the handshake and identify
+	ConnectTime time.Duration
+	// HandshakeTime is how long it took to dial the transport and negotiate security and the stream multiplexer.
+	// For relayed addresses it includes connecting to the relay.
+	HandshakeTime time.Duration
+	Stats         *PingStats
+	Error         error
+}
+
+func (o *AddrPingResult) MarshalJSON() ([]byte, error) {
+	var errorMsg *string
+	if o.Error != nil {
+		m := o.Error.Error()
+		errorMsg = &m
+	}
+	anon := struct {
+		Addr          multiaddr.Multiaddr
+		Transport     string
+		ConnectTime   string
+		HandshakeTime string
+		Stats         *PingStats
+		Error         *string
+	}{
+		Addr:          o.Addr,
+		Transport:     o.Transport,
+		ConnectTime:   o.ConnectTime.String(),
+		HandshakeTime: o.HandshakeTime.String(),
+		Stats:         o.Stats,
+		Error:         errorMsg,
+	}
+	return json.Marshal(anon)
+}
+
+var _ json.Marshaler = (*AddrPingResult)(nil)
+
+// PingAddrs pings the peer over each of its addresses in turn, every time from a new libp2p host that only knows that address,
+// so that each transport is measured on a connection of its own. Connecting to each address is given at most the ping timeout.
+// onResult is called as each address is done.
+func PingAddrs(ctx context.Context, p *peer.AddrInfo, onResult func(*AddrPingResult), opts ...PingOption) {
+	cfg := newPingConfig(opts...)
+	for _, a := range p.Addrs {
+		if ctx.Err() != nil {
+			return
+		}
+		onResult(pingAddr(ctx, p.ID, a, cfg))
+	}
+}
+
+func pingAddr(ctx context.Context, p peer.ID, a multiaddr.Multiaddr, cfg pingConfig) *AddrPingResult {
+	res := &AddrPingResult{Addr: a, Transport: AddrTransport(a)}
+
+	tracer := &handshakeTracer{}
+	h, err := newHost(libp2p.DisableMetrics(), libp2p.SwarmOpts(swarm.WithMetricsTracer(tracer)))
+	if err != nil {
+		res.Error = err
+		return res
+	}
+	defer h.Close()
+
+	// relayed connections are limited, and are the ones we want to measure for relay addresses
+	ctx = network.WithAllowLimitedConn(ctx, "ping")
+	cctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+	defer cancel()
+	start := time.Now()
+	if err := h.Connect(cctx, peer.AddrInfo{ID: p, Addrs: []multiaddr.Multiaddr{a}}); err != nil {
+		res.Error = classifyPingError(err, PingErrorDial)
+		return res
+	}
+	res.ConnectTime = time.Since(start)
+	res.HandshakeTime = tracer.handshake()
+
+	// a hole punch could add a direct connection next to a relayed one, stick to the one of the address' transport
+	var conn network.Conn
+	for _, c := range h.Network().ConnsToPeer(p) {
+		if AddrTransport(c.RemoteMultiaddr()) == res.Transport {
+			conn = c
+			break
+		}
+	}
+	if conn == nil {
+		res.Error = &PingError{Kind: PingErrorDial, Err: fmt.Errorf("connected to %s over a different transport than %s", p, res.Transport)}
+		return res
+	}
+
+	res.Stats, res.Error = pingStream(ctx, p, []multiaddr.Multiaddr{a}, cfg, func(ctx context.Context) (network.Stream, error) {
+		s, err := conn.NewStream(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := msmux.SelectProtoOrFail(pingProtocol, s); err != nil {
+			_ = s.Reset()
+			return nil, err
+		}
+		_ = s.SetProtocol(pingProtocol)
+		return s, nil
+	})
+	return res
+}
+
+// handshakeTracer records how long the last outbound connection of a swarm took to be established
+type handshakeTracer struct {
+	mu sync.Mutex
+	d  time.Duration
+}
+
+func (t *handshakeTracer) handshake() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.d
+}
+
+func (t *handshakeTracer) CompletedHandshake(d time.Duration, _ network.ConnectionState, _ multiaddr.Multiaddr) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.d = d
+}
+
+func (t *handshakeTracer) OpenedConnection(network.Direction, crypto.PubKey, network.ConnectionState, multiaddr.Multiaddr) {
+}
+
+func (t *handshakeTracer) ClosedConnection(network.Direction, time.Duration, network.ConnectionState, multiaddr.Multiaddr) {
+}
+
+func (t *handshakeTracer) FailedDialing(multiaddr.Multiaddr, error, error) {}
+
+func (t *handshakeTracer) DialCompleted(bool, int, time.Duration) {}
+
+func (t *handshakeTracer) DialRankingDelay(time.Duration) {}
+
+func (t *handshakeTracer) UpdatedBlackHoleSuccessCounter(string, swarm.BlackHoleState, int, float64) {
+}
+
+var _ swarm.MetricsTracer = (*handshakeTracer)(nil)
@@ -0,0 +1,54 @@
+package vole
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestPingAddrs(t *testing.T) {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0", "/ip4/127.0.0.1/tcp/0/ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	unreachable := multiaddr.StringCast("/ip4/127.0.0.1/tcp/1")
+	p := peer.AddrInfo{
+		ID:    h.ID(),
+		Addrs: append(h.Addrs(), unreachable),
+	}
+
+	results := make(map[string]*AddrPingResult)
+	PingAddrs(context.Background(), &p, func(r *AddrPingResult) {
+		results[r.Addr.String()] = r
+	}, PingCount(2), PingInterval(time.Millisecond*10), PingTimeout(time.Second*5))
+	if len(results) != len(p.Addrs) {
+		t.Fatalf("expected %d results, got %d", len(p.Addrs), len(results))
+	}
+
+	transports := make(map[string]bool)
+	for _, a := range h.Addrs() {
+		r := results[a.String()]
+		if r.Error != nil {
+			t.Fatalf("%s: %v", a, r.Error)
+		}
+		if r.Stats.Received != 2 {
+			t.Fatalf("%s: expected 2 replies, got %+v", a, r.Stats)
+		}
+		if r.HandshakeTime <= 0 || r.HandshakeTime > r.ConnectTime {
+			t.Fatalf("%s: expected the handshake to take part of the connect time, got %s and %s", a, r.HandshakeTime, r.ConnectTime)
+		}
+		transports[r.Transport] = true
+	}
+	if !transports["tcp"] || !transports["ws"] {
+		t.Fatalf("expected to ping over tcp and ws, got %v", transports)
+	}
+	if results[unreachable.String()].Error == nil {
+		t.Fatal("expected pinging an unreachable address to fail")
+	}
+}
@@ -0,0 +1,80 @@
+package vole
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+// PingErrorKind tells at which point a ping failed
+type PingErrorKind string
+
+const (
+	// PingErrorDial is a failure to connect to the peer or to open a stream to it
+	PingErrorDial PingErrorKind = "dial"
+	// PingErrorNegotiation is the peer refusing the ping protocol
+	PingErrorNegotiation PingErrorKind = "negotiation"
+	// PingErrorTimeout is a reply, connection or stream that did not come in time
+	PingErrorTimeout PingErrorKind = "timeout"
+	// PingErrorReset is the stream being reset while pinging
+	PingErrorReset PingErrorKind = "reset"
+	// PingErrorShortRead is the stream being closed before the whole reply was read
+	PingErrorShortRead PingErrorKind = "short read"
+	// PingErrorMismatch is a reply that does not echo what was sent
+	PingErrorMismatch PingErrorKind = "mismatch"
+	// PingErrorOther is any other failure, such as failing to send the ping
+	PingErrorOther PingErrorKind = "other"
+)
+
+// PingError is a classified ping failure
+type PingError struct {
+	Kind PingErrorKind
+	Err  error
+}
+
+func (e *PingError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+}
+
+func (e *PingError) Unwrap() error {
+	return e.Err
+}
+
+// PingErrorKindOf returns the kind of a ping error, or PingErrorOther if the error was not classified
+func PingErrorKindOf(err error) PingErrorKind {
+	var pErr *PingError
+	if errors.As(err, &pErr) {
+		return pErr.Kind
+	}
+	return PingErrorOther
+}
+
+// classifyPingError wraps err in a PingError, using fallback when the error itself does not tell what went wrong
+func classifyPingError(err error, fallback PingErrorKind) error {
+	if err == nil {
+		return nil
+	}
+	var pErr *PingError
+	if errors.As(err, &pErr) {
+		return err
+	}
+
+	kind := fallback
+	var netErr net.Error
+	switch {
+	case errors.Is(err, msmux.ErrNotSupported[protocol.ID]{}):
+		kind = PingErrorNegotiation
+	case errors.Is(err, network.ErrReset):
+		kind = PingErrorReset
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		kind = PingErrorTimeout
+	}
+	return &PingError{Kind: kind, Err: err}
+}
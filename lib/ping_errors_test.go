@@ -0,0 +1,88 @@
+package vole
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestPingErrors(t *testing.T) {
+	echo := func(transform func(b []byte) []byte) network.StreamHandler {
+		return func(s network.Stream) {
+			b := make([]byte, 32)
+			if _, err := io.ReadFull(s, b); err != nil {
+				_ = s.Reset()
+				return
+			}
+			_, _ = s.Write(transform(b))
+			_ = s.Close()
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		handler network.StreamHandler
+		kind    PingErrorKind
+	}{
+		{"mismatch", echo(func(b []byte) []byte { b[0]++; return b }), PingErrorMismatch},
+		{"short read", echo(func(b []byte) []byte { return b[:10] }), PingErrorShortRead},
+		{"reset", func(s network.Stream) { _ = s.Reset() }, PingErrorReset},
+		{"timeout", func(s network.Stream) { _, _ = io.Copy(io.Discard, s) }, PingErrorTimeout},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close()
+			h.SetStreamHandler(pingProtocol, tc.handler)
+
+			var pingErr error
+			stats, err := PingPeer(context.Background(), false, &peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()},
+				PingCount(1), PingTimeout(time.Millisecond*200), PingReporter(func(r PingResult) {
+					pingErr = r.Error
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Received != 0 {
+				t.Fatalf("expected the ping to be lost, got %+v", stats)
+			}
+			if kind := PingErrorKindOf(pingErr); kind != tc.kind {
+				t.Fatalf("expected a %s error, got %s: %v", tc.kind, kind, pingErr)
+			}
+		})
+	}
+
+	t.Run("negotiation", func(t *testing.T) {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.Ping(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+
+		_, err = PingPeer(context.Background(), false, &peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}, PingCount(1))
+		if kind := PingErrorKindOf(err); kind != PingErrorNegotiation {
+			t.Fatalf("expected a negotiation error, got %s: %v", kind, err)
+		}
+	})
+
+	t.Run("dial", func(t *testing.T) {
+		p, err := peer.Decode("12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = PingPeer(context.Background(), false, &peer.AddrInfo{ID: p, Addrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/1")}})
+		var pErr *PingError
+		if !errors.As(err, &pErr) || pErr.Kind != PingErrorDial {
+			t.Fatalf("expected a dial error, got %v", err)
+		}
+	})
+}
@@ -2,7 +2,9 @@ package vole
 
 import (
 	"context"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -25,3 +27,82 @@ func TestPing(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPingPeer(t *testing.T) {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	p := peer.AddrInfo{
+		ID:    h.ID(),
+		Addrs: h.Addrs(),
+	}
+
+	var results []PingResult
+	stats, err := PingPeer(context.Background(), false, &p, PingCount(4), PingInterval(time.Millisecond*10), PingReporter(func(r PingResult) {
+		results = append(results, r)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 || stats.Sent != 4 || stats.Received != 4 || stats.Loss != 0 {
+		t.Fatalf("expected 4 successful pings, got %d results and %+v", len(results), stats)
+	}
+	if stats.Min > stats.Avg || stats.Avg > stats.Max {
+		t.Fatalf("expected min <= avg <= max, got %+v", stats)
+	}
+	if stats.Conn == nil || stats.Conn.Transport != "tcp" || stats.Conn.Relayed {
+		t.Fatalf("expected to ping over a direct tcp connection, got %+v", stats.Conn)
+	}
+}
+
+func TestPingPeerUntilCanceled(t *testing.T) {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	p := peer.AddrInfo{
+		ID:    h.ID(),
+		Addrs: h.Addrs(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stats, err := PingPeer(ctx, false, &p, PingCount(0), PingInterval(time.Millisecond*10), PingReporter(func(r PingResult) {
+		if r.Seq == 5 {
+			cancel()
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Sent != 5 {
+		t.Fatalf("expected to stop after 5 pings, sent %d", stats.Sent)
+	}
+}
+
+func TestNewPingStats(t *testing.T) {
+	ms := time.Millisecond
+	s := newPingStats("", 5, []time.Duration{10 * ms, 20 * ms, 30 * ms, 20 * ms})
+	if s.Received != 4 || s.Loss != 20 {
+		t.Fatalf("expected 4 replies and 20%% loss, got %d and %v", s.Received, s.Loss)
+	}
+	if s.Min != 10*ms || s.Max != 30*ms || s.Avg != 20*ms {
+		t.Fatalf("unexpected min/avg/max %s/%s/%s", s.Min, s.Avg, s.Max)
+	}
+	if s.Jitter != 10*ms {
+		t.Fatalf("expected 10ms of jitter, got %s", s.Jitter)
+	}
+	// sqrt((100+0+100+0)/4) ms
+	if expected := time.Duration(math.Sqrt(50) * float64(ms)); s.StdDev != expected {
+		t.Fatalf("expected a standard deviation of %s, got %s", expected, s.StdDev)
+	}
+
+	if s := newPingStats("", 3, nil); s.Loss != 100 || s.Avg != 0 {
+		t.Fatalf("expected total loss, got %+v", s)
+	}
+}
@@ -0,0 +1,138 @@
+package vole
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+// WellKnownProtocols are commonly served protocols worth probing for even when a peer does not advertise them
+var WellKnownProtocols = []protocol.ID{
+	"/ipfs/bitswap/1.2.0",
+	"/ipfs/bitswap/1.1.0",
+	"/ipfs/bitswap/1.0.0",
+	"/ipfs/bitswap",
+	"/ipfs/kad/1.0.0",
+	"/ipfs/ping/1.0.0",
+	"/ipfs/id/1.0.0",
+	"/ipfs/id/push/1.0.0",
+	"/libp2p/autonat/1.0.0",
+	"/libp2p/autonat/2/dial-request",
+	"/libp2p/circuit/relay/0.2.0/hop",
+	"/libp2p/dcutr",
+	"/libp2p/fetch/0.0.1",
+	"/meshsub/1.2.0",
+	"/meshsub/1.1.0",
+	"/meshsub/1.0.0",
+	"/floodsub/1.0.0",
+}
+
+// ProtocolStatus compares what a peer advertised for a protocol with whether it agreed to speak it
+type ProtocolStatus string
+
+const (
+	ProtocolSupported            ProtocolStatus = "supported"
+	ProtocolAdvertisedButRefused ProtocolStatus = "advertised but refused"
+	ProtocolUnadvertisedButWorks ProtocolStatus = "unadvertised but works"
+	ProtocolUnsupported          ProtocolStatus = "unsupported"
+	// ProtocolUnknown means the negotiation failed for another reason than the peer refusing, see Error
+	ProtocolUnknown ProtocolStatus = "unknown"
+)
+
+// ProtocolProbe is the outcome of trying to negotiate a protocol with a peer
+type ProtocolProbe struct {
+	Protocol   protocol.ID
+	Advertised bool
+	Negotiated bool
+	Status     ProtocolStatus
+	Error      error
+}
+
+func (o *ProtocolProbe) MarshalJSON() ([]byte, error) {
+	var errorMsg *string
+	if o.Error != nil {
+		m := o.Error.Error()
+		errorMsg = &m
+	}
+	type protocolProbe ProtocolProbe
+	anon := struct {
+		*protocolProbe
+		Error *string
+	}{
+		protocolProbe: (*protocolProbe)(o),
+		Error:         errorMsg,
+	}
+	return json.Marshal(anon)
+}
+
+var _ json.Marshaler = (*ProtocolProbe)(nil)
+
+// probeProtocols runs a multistream-select negotiation with the connected peer for each of the advertised and extra protocols.
+// The results are sorted by protocol.
+func probeProtocols(ctx context.Context, h host.Host, p peer.ID, advertised, extra []protocol.ID) []*ProtocolProbe {
+	const (
+		maxConcurrentProbes = 8
+		probeTimeout        = time.Second * 10
+	)
+
+	probes := make(map[protocol.ID]*ProtocolProbe)
+	for _, proto := range advertised {
+		probes[proto] = &ProtocolProbe{Protocol: proto, Advertised: true}
+	}
+	for _, proto := range extra {
+		if _, ok := probes[proto]; !ok {
+			probes[proto] = &ProtocolProbe{Protocol: proto}
+		}
+	}
+
+	sem := make(chan struct{}, maxConcurrentProbes)
+	var wg sync.WaitGroup
+	for _, pr := range probes {
+		wg.Add(1)
+		go func(pr *ProtocolProbe) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			tctx, cancel := context.WithTimeout(ctx, probeTimeout)
+			defer cancel()
+			_, err := negotiateProtocol(tctx, h, p, pr.Protocol)
+			pr.Negotiated = err == nil
+			if err != nil && !errors.Is(err, msmux.ErrNotSupported[protocol.ID]{}) {
+				pr.Error = err
+			}
+			pr.Status = protocolStatus(pr)
+		}(pr)
+	}
+	wg.Wait()
+
+	res := make([]*ProtocolProbe, 0, len(probes))
+	for _, pr := range probes {
+		res = append(res, pr)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Protocol < res[j].Protocol })
+	return res
+}
+
+func protocolStatus(pr *ProtocolProbe) ProtocolStatus {
+	switch {
+	case pr.Error != nil:
+		return ProtocolUnknown
+	case pr.Negotiated && pr.Advertised:
+		return ProtocolSupported
+	case pr.Negotiated:
+		return ProtocolUnadvertisedButWorks
+	case pr.Advertised:
+		return ProtocolAdvertisedButRefused
+	default:
+		return ProtocolUnsupported
+	}
+}
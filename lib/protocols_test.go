@@ -0,0 +1,58 @@
+package vole
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+func TestIdentifyProbeProtocols(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const (
+		advertised   = protocol.ID("/test/advertised/1.0.0")
+		refused      = protocol.ID("/test/refused/1.0.0")
+		unadvertised = protocol.ID("/test/unadvertised/1.0.0")
+		missing      = protocol.ID("/test/missing/1.0.0")
+	)
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	h.SetStreamHandler(advertised, func(s network.Stream) { _ = s.Close() })
+	// handlers registered with a match function are advertised under their name but accept whatever the function matches
+	h.SetStreamHandlerMatch(refused, func(p protocol.ID) bool { return p == unadvertised }, func(s network.Stream) { _ = s.Close() })
+
+	hostAddrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := IdentifyRequest(ctx, hostAddrs[0].String(), false, IdentifyProbeProtocols(unadvertised, missing))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(map[protocol.ID]ProtocolStatus)
+	for _, pr := range resp.ProtocolProbes {
+		statuses[pr.Protocol] = pr.Status
+	}
+	for proto, expected := range map[protocol.ID]ProtocolStatus{
+		advertised:   ProtocolSupported,
+		refused:      ProtocolAdvertisedButRefused,
+		unadvertised: ProtocolUnadvertisedButWorks,
+		missing:      ProtocolUnsupported,
+	} {
+		if statuses[proto] != expected {
+			t.Fatalf("expected %s to be %q, got %q", proto, expected, statuses[proto])
+		}
+	}
+	if len(resp.ProtocolProbes) != len(resp.Protocols)+2 {
+		t.Fatalf("expected every advertised protocol to be probed, got %d probes for %d protocols", len(resp.ProtocolProbes), len(resp.Protocols))
+	}
+}
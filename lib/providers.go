@@ -0,0 +1,179 @@
+package vole
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// ProviderAddrQuality summarizes how usable the addresses in a provider record are
+type ProviderAddrQuality string
+
+const (
+	// ProviderAddrsEmpty means the record carried no addresses, so the provider has to be found some other way
+	ProviderAddrsEmpty ProviderAddrQuality = "empty"
+	// ProviderAddrsPrivateOnly means none of the addresses can be dialed from the public internet
+	ProviderAddrsPrivateOnly ProviderAddrQuality = "private-only"
+	// ProviderAddrsRelayOnly means the provider can only be reached through a relay
+	ProviderAddrsRelayOnly ProviderAddrQuality = "relay-only"
+	// ProviderAddrsPublic means at least one address is directly dialable from the public internet
+	ProviderAddrsPublic ProviderAddrQuality = "public"
+)
+
+// ProviderCheck is the result of dialing a provider returned by a DHT node
+type ProviderCheck struct {
+	ID          peer.ID
+	RecordAddrs []multiaddr.Multiaddr
+	AddrQuality ProviderAddrQuality
+	// LookedUpAddrs is set when the record had no addresses and the DHT node was asked for the provider's addresses instead
+	LookedUpAddrs []multiaddr.Multiaddr
+	Reachable     bool
+	ConnectedAddr multiaddr.Multiaddr
+	// ConnectTime is how long it took to connect to and identify the provider
+	ConnectTime  time.Duration
+	RTT          time.Duration
+	AgentVersion string
+	// Bitswap is set when the provider agreed to speak bitswap, regardless of the BitswapProtocols it advertised
+	Bitswap          bool
+	BitswapProtocols []protocol.ID
+	Error            error
+}
+
+func (o *ProviderCheck) MarshalJSON() ([]byte, error) {
+	var errorMsg *string
+	if o.Error != nil {
+		m := o.Error.Error()
+		errorMsg = &m
+	}
+	type providerCheck ProviderCheck
+	anon := struct {
+		*providerCheck
+		ConnectTime string
+		RTT         string
+		Error       *string
+	}{
+		providerCheck: (*providerCheck)(o),
+		ConnectTime:   o.ConnectTime.String(),
+		RTT:           o.RTT.String(),
+		Error:         errorMsg,
+	}
+	return json.Marshal(anon)
+}
+
+var _ json.Marshaler = (*ProviderCheck)(nil)
+
+// ClassifyProviderAddrs returns the quality of the addresses found in a provider record
+func ClassifyProviderAddrs(addrs []multiaddr.Multiaddr) ProviderAddrQuality {
+	if len(addrs) == 0 {
+		return ProviderAddrsEmpty
+	}
+	relayed := 0
+	for _, a := range addrs {
+		switch ClassifyAddrScope(a) {
+		case AddrScopePublic:
+			return ProviderAddrsPublic
+		case AddrScopeRelay:
+			relayed++
+		}
+	}
+	if relayed == len(addrs) {
+		return ProviderAddrsRelayOnly
+	}
+	return ProviderAddrsPrivateOnly
+}
+
+// VerifyProviders dials each of the providers, identifies them and reports whether they are usable.
+// Providers whose record has no addresses are looked up on the client's target DHT node.
+// Each provider is given at most timeout to respond.
+func (c *DhtClient) VerifyProviders(ctx context.Context, provs []*peer.AddrInfo, timeout time.Duration) []*ProviderCheck {
+	const maxConcurrentDials = 16
+
+	results := make([]*ProviderCheck, len(provs))
+	sem := make(chan struct{}, maxConcurrentDials)
+	var wg sync.WaitGroup
+	for i, p := range provs {
+		wg.Add(1)
+		go func(i int, p *peer.AddrInfo) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			tctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			results[i] = c.verifyProvider(tctx, p)
+		}(i, p)
+	}
+	wg.Wait()
+	return results
+}
+
+func (c *DhtClient) verifyProvider(ctx context.Context, p *peer.AddrInfo) *ProviderCheck {
+	res := &ProviderCheck{
+		ID:          p.ID,
+		RecordAddrs: p.Addrs,
+		AddrQuality: ClassifyProviderAddrs(p.Addrs),
+	}
+
+	dialAddrs := p.Addrs
+	if len(dialAddrs) == 0 {
+		closest, err := c.m.GetClosestPeers(ctx, c.target, p.ID)
+		if err != nil {
+			res.Error = err
+			return res
+		}
+		for _, ai := range closest {
+			if ai.ID == p.ID {
+				res.LookedUpAddrs = ai.Addrs
+			}
+		}
+		dialAddrs = res.LookedUpAddrs
+	}
+
+	start := time.Now()
+	if err := c.h.Connect(ctx, peer.AddrInfo{ID: p.ID, Addrs: dialAddrs}); err != nil {
+		res.Error = err
+		return res
+	}
+	res.ConnectTime = time.Since(start)
+	res.Reachable = true
+
+	if conns := c.h.Network().ConnsToPeer(p.ID); len(conns) > 0 {
+		res.ConnectedAddr = conns[0].RemoteMultiaddr()
+	}
+
+	ps := c.h.Peerstore()
+	if v, err := ps.Get(p.ID, "AgentVersion"); err == nil {
+		if vs, ok := v.(string); ok {
+			res.AgentVersion = vs
+		}
+	}
+	protos, err := ps.GetProtocols(p.ID)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+	for _, proto := range protos {
+		if strings.HasPrefix(string(proto), "/ipfs/bitswap") {
+			res.BitswapProtocols = append(res.BitswapProtocols, proto)
+		}
+	}
+
+	// peers can advertise protocols they won't serve, so check that one of the bitswap versions is actually accepted
+	if _, err := negotiateProtocol(ctx, c.h, p.ID, bitswapProtocols...); err == nil {
+		res.Bitswap = true
+	}
+
+	// not every provider runs the ping protocol, so a failure here only means we have no RTT
+	if pr := <-ping.Ping(ctx, c.h, p.ID); pr.Error == nil {
+		res.RTT = pr.RTT
+	}
+
+	return res
+}
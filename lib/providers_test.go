@@ -0,0 +1,94 @@
+package vole
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestClassifyProviderAddrs(t *testing.T) {
+	for _, tc := range []struct {
+		addrs    []string
+		expected ProviderAddrQuality
+	}{
+		{nil, ProviderAddrsEmpty},
+		{[]string{"/ip4/127.0.0.1/tcp/4001", "/ip4/192.168.1.2/udp/4001/quic-v1"}, ProviderAddrsPrivateOnly},
+		{[]string{"/ip4/1.2.3.4/tcp/4001/p2p/12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN/p2p-circuit"}, ProviderAddrsRelayOnly},
+		{[]string{"/ip4/192.168.1.2/tcp/4001", "/ip4/1.2.3.4/tcp/4001"}, ProviderAddrsPublic},
+	} {
+		var addrs []multiaddr.Multiaddr
+		for _, a := range tc.addrs {
+			addrs = append(addrs, multiaddr.StringCast(a))
+		}
+		if q := ClassifyProviderAddrs(addrs); q != tc.expected {
+			t.Fatalf("%v: expected %q, got %q", tc.addrs, tc.expected, q)
+		}
+	}
+}
+
+func TestVerifyProviders(t *testing.T) {
+	defer func() { _ = SetHostConfig(HostConfig{}) }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := SetHostConfig(HostConfig{ListenAddrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/0")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewDhtServer(ctx, DhtServerConfig{
+		Protocol: "/test/kad/1.0.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	bsProv, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bsProv.Close()
+	bsProv.SetStreamHandler("/ipfs/bitswap/1.2.0", func(s network.Stream) { _ = s.Close() })
+
+	nonBsProv, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nonBsProv.Close()
+
+	ai := s.AddrInfo()
+	c, err := NewDhtClient(ctx, "/test/kad/1.0.0", &ai)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	unreachable, err := peer.Decode("12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := c.VerifyProviders(ctx, []*peer.AddrInfo{
+		{ID: bsProv.ID(), Addrs: bsProv.Addrs()},
+		{ID: nonBsProv.ID(), Addrs: nonBsProv.Addrs()},
+		{ID: unreachable},
+	}, time.Second*5)
+
+	if !res[0].Reachable || !res[0].Bitswap || res[0].AddrQuality != ProviderAddrsPrivateOnly || res[0].ConnectedAddr == nil {
+		t.Fatalf("expected a reachable bitswap provider, got %+v", res[0])
+	}
+	if !res[1].Reachable || res[1].Bitswap {
+		t.Fatalf("expected a reachable provider without bitswap, got %+v", res[1])
+	}
+	if res[2].Reachable || res[2].AddrQuality != ProviderAddrsEmpty || res[2].Error == nil {
+		t.Fatalf("expected an unreachable provider without addresses, got %+v", res[2])
+	}
+
+	if _, err := res[0].MarshalJSON(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,171 @@
+package vole
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// relayReserveTimeout is how long to wait for a relay to accept a reservation
+	relayReserveTimeout = 10 * time.Second
+	// relayRefreshMargin is how long before a reservation expires it is renewed
+	relayRefreshMargin = time.Minute
+	// relayRetryInterval is how long to wait before trying again when a reservation could not be made or renewed
+	relayRetryInterval = 30 * time.Second
+)
+
+// RelayReservation is a circuit relay v2 reservation vole's libp2p peer made, which lets other peers reach it through the relay
+type RelayReservation struct {
+	Relay peer.ID
+	// Addrs are the relayed addresses other peers can reach us on, including our peer ID
+	Addrs      []multiaddr.Multiaddr
+	Expiration time.Time
+	// LimitDuration and LimitData are how long and how many bytes in each direction the relay keeps a relayed connection open for, 0 when unlimited
+	LimitDuration time.Duration
+	LimitData     uint64
+	// Renewal is set when the reservation extends an earlier one
+	Renewal bool
+	Error   error
+}
+
+// circuitAddrs returns the addresses to reach a peer through the relays, without the peer ID of the peer
+func circuitAddrs(relays []peer.AddrInfo) []multiaddr.Multiaddr {
+	circuit := multiaddr.StringCast("/p2p-circuit")
+	var addrs []multiaddr.Multiaddr
+	for _, r := range relays {
+		p2pAddrs, err := peer.AddrInfoToP2pAddrs(&r)
+		if err != nil {
+			continue
+		}
+		for _, a := range p2pAddrs {
+			addrs = append(addrs, a.Encapsulate(circuit))
+		}
+	}
+	return addrs
+}
+
+// relayReservations keeps reservations on the configured relays for a host and advertises the relayed addresses of the ones it holds
+type relayReservations struct {
+	relays        []peer.AddrInfo
+	onReservation func(*RelayReservation)
+
+	mu       sync.Mutex
+	reserved map[peer.ID]bool
+}
+
+func newRelayReservations(relays []peer.AddrInfo, onReservation func(*RelayReservation)) *relayReservations {
+	return &relayReservations{relays: relays, onReservation: onReservation, reserved: make(map[peer.ID]bool)}
+}
+
+// addrsFactory adds the relayed addresses of the reservations held to the addresses of the host
+func (r *relayReservations) addrsFactory(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, relay := range r.relays {
+		if r.reserved[relay.ID] {
+			addrs = append(addrs, circuitAddrs([]peer.AddrInfo{relay})...)
+		}
+	}
+	return addrs
+}
+
+// start makes a reservation on every relay, failing when none accepted one, then keeps renewing them until the returned host is closed
+func (r *relayReservations) start(h host.Host) (host.Host, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var errs []error
+	expirations := make([]time.Time, len(r.relays))
+	for i, relay := range r.relays {
+		h.ConnManager().Protect(relay.ID, "vole-relay")
+		res := r.reserve(ctx, h, relay, false)
+		if res.Error != nil {
+			errs = append(errs, fmt.Errorf("relay %s: %w", relay.ID, res.Error))
+		}
+		expirations[i] = res.Expiration
+	}
+	if len(errs) == len(r.relays) {
+		cancel()
+		return nil, errors.Join(errs...)
+	}
+	if s, ok := h.(interface{ SignalAddressChange() }); ok {
+		// advertise the relayed addresses right away rather than on the next address check
+		s.SignalAddressChange()
+	}
+
+	rh := &relayingHost{Host: h, stop: cancel}
+	for i, relay := range r.relays {
+		rh.wg.Add(1)
+		go func() {
+			defer rh.wg.Done()
+			r.keepReserved(ctx, h, relay, expirations[i])
+		}()
+	}
+	return rh, nil
+}
+
+// keepReserved renews the reservation on the relay shortly before it expires, or retries a failed one, until the context is done
+func (r *relayReservations) keepReserved(ctx context.Context, h host.Host, relay peer.AddrInfo, expiration time.Time) {
+	for {
+		wait := relayRetryInterval
+		if !expiration.IsZero() {
+			wait = max(time.Until(expiration)-relayRefreshMargin, time.Second)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		expiration = r.reserve(ctx, h, relay, !expiration.IsZero()).Expiration
+	}
+}
+
+// reserve makes or renews the reservation on the relay and reports it
+func (r *relayReservations) reserve(ctx context.Context, h host.Host, relay peer.AddrInfo, renewal bool) *RelayReservation {
+	rctx, cancel := context.WithTimeout(ctx, relayReserveTimeout)
+	defer cancel()
+	res := &RelayReservation{Relay: relay.ID, Renewal: renewal}
+	rsvp, err := client.Reserve(rctx, h, relay)
+	if ctx.Err() != nil {
+		// the host is closing
+		return res
+	}
+
+	r.mu.Lock()
+	r.reserved[relay.ID] = err == nil
+	r.mu.Unlock()
+	if err != nil {
+		res.Error = err
+	} else {
+		self := multiaddr.StringCast("/p2p/" + h.ID().String())
+		for _, a := range circuitAddrs([]peer.AddrInfo{relay}) {
+			res.Addrs = append(res.Addrs, a.Encapsulate(self))
+		}
+		res.Expiration = rsvp.Expiration
+		res.LimitDuration = rsvp.LimitDuration
+		res.LimitData = rsvp.LimitData
+	}
+	if r.onReservation != nil {
+		r.onReservation(res)
+	}
+	return res
+}
+
+// relayingHost is a host holding relay reservations, closing it stops renewing them
+type relayingHost struct {
+	host.Host
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+func (h *relayingHost) Close() error {
+	h.stop()
+	h.wg.Wait()
+	return h.Host.Close()
+}
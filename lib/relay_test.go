@@ -0,0 +1,87 @@
+package vole
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestRelayReservations(t *testing.T) {
+	defer func() { _ = SetHostConfig(HostConfig{}) }()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	relay, err := libp2p.New(
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.EnableRelayService(),
+		libp2p.ForceReachabilityPublic(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+	relayInfo := peer.AddrInfo{ID: relay.ID(), Addrs: relay.Addrs()}
+
+	var mu sync.Mutex
+	var reservations []*RelayReservation
+	err = SetHostConfig(HostConfig{
+		ListenAddrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/0")},
+		Relays:      []peer.AddrInfo{relayInfo},
+		OnReservation: func(r *RelayReservation) {
+			mu.Lock()
+			defer mu.Unlock()
+			reservations = append(reservations, r)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := libp2pHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	mu.Lock()
+	if len(reservations) != 1 || reservations[0].Error != nil || reservations[0].Relay != relay.ID() {
+		t.Fatalf("expected a reservation on the relay, got %+v", reservations)
+	}
+	if len(reservations[0].Addrs) == 0 || !isRelayedAddr(reservations[0].Addrs[0]) {
+		t.Fatalf("expected relayed addresses, got %v", reservations[0].Addrs)
+	}
+	mu.Unlock()
+	advertised := false
+	for _, a := range h.Addrs() {
+		advertised = advertised || isRelayedAddr(a)
+	}
+	if !advertised {
+		t.Fatalf("expected the host to advertise its relayed address, got %v", h.Addrs())
+	}
+
+	// given the direct addresses, force-relay goes through the configured relay instead
+	stats, err := PingPeer(ctx, true, &peer.AddrInfo{ID: h.ID(), Addrs: h.Network().ListenAddresses()}, PingCount(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Received != 1 || !stats.Conn.Relayed {
+		t.Fatalf("expected a ping over the relay, got %+v", stats)
+	}
+
+	if err := SetHostConfig(HostConfig{Relays: []peer.AddrInfo{{ID: relay.ID()}}}); err == nil {
+		t.Fatal("expected a relay without addresses to be rejected")
+	}
+	relay.Close()
+	if err := SetHostConfig(HostConfig{Relays: []peer.AddrInfo{relayInfo}}); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := libp2pHost(); err == nil {
+		h.Close()
+		t.Fatal("expected creating a host to fail without a reservation")
+	}
+}
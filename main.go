@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
+	"text/template"
+	"time"
 
 	madns "github.com/multiformats/go-multiaddr-dns"
 
@@ -12,6 +15,7 @@ import (
 	"github.com/urfave/cli/v2"
 
 	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
@@ -34,6 +38,8 @@ func main() {
 				Email: "adin.schmahmann@gmail.com",
 			},
 		},
+		Flags:  hostFlags,
+		Before: configureHost,
 		Commands: []*cli.Command{
 			{
 				Name:  "bitswap",
@@ -49,22 +55,17 @@ func main() {
 				Subcommands: []*cli.Command{
 					{
 						Name:        "put",
-						ArgsUsage:   "<multibase-bytes-key> <multibase-bytes-value> <multiaddr>",
+						ArgsUsage:   "[<multibase-bytes-key>] <multibase-bytes-value> <multiaddr>",
 						Usage:       "put a record to a DHT node",
-						Description: "creates a libp2p peer and sends a DHT put request to the target",
+						Description: "creates a libp2p peer and sends a DHT put request to the target - the key can be given as typed flags instead of multibase bytes",
 						Action: func(c *cli.Context) error {
-							if c.NArg() != 3 {
-								return fmt.Errorf("invalid number of arguments")
-							}
-							keyStr := c.Args().Get(0)
-							valStr := c.Args().Get(1)
-							maStr := c.Args().Get(2)
-							protoID := c.String("protocolID")
-
-							_, keyBytes, err := multibase.Decode(keyStr)
+							keyBytes, args, err := dhtKeyAndArgs(c, 2, vole.DhtKeyIPNS)
 							if err != nil {
 								return err
 							}
+							valStr := args[0]
+							maStr := args[1]
+							protoID := c.String("protocolID")
 
 							_, valBytes, err := multibase.Decode(valStr)
 							if err != nil {
@@ -76,35 +77,30 @@ func main() {
 								return err
 							}
 
-							return vole.DhtPut(c.Context, keyBytes, valBytes, protocol.ID(protoID), ma)
+							return vole.DhtPut(c.Context, keyBytes, valBytes, protocol.ID(protoID), ma, dhtOptions(c)...)
 						},
-						Flags: []cli.Flag{
+						Flags: append([]cli.Flag{
 							&cli.StringFlag{
 								Name:        "protocolID",
 								Usage:       "the protocol ID",
 								DefaultText: "/ipfs/kad/1.0.0",
 								Value:       "/ipfs/kad/1.0.0",
 							},
-						},
+						}, append(dhtKeyFlags, dhtRequestFlags...)...),
 					},
 					{
 						Name:        "get",
-						ArgsUsage:   "<multibase-bytes-key> <multiaddr>",
+						ArgsUsage:   "[<multibase-bytes-key>] <multiaddr>",
 						Usage:       "get a record from a DHT node",
-						Description: "creates a libp2p peer and sends a DHT get request to the target",
+						Description: "creates a libp2p peer and sends a DHT get request to the target - the key can be given as typed flags instead of multibase bytes",
 						Action: func(c *cli.Context) error {
-							if c.NArg() != 2 {
-								return fmt.Errorf("invalid number of arguments")
-							}
-							keyStr := c.Args().Get(0)
-							maStr := c.Args().Get(1)
-							protoID := c.String("protocolID")
-							base := c.String("base")
-
-							_, keyBytes, err := multibase.Decode(keyStr)
+							keyBytes, args, err := dhtKeyAndArgs(c, 1, vole.DhtKeyIPNS)
 							if err != nil {
 								return err
 							}
+							maStr := args[0]
+							protoID := c.String("protocolID")
+							base := c.String("base")
 
 							ma, err := multiaddr.NewMultiaddr(maStr)
 							if err != nil {
@@ -116,7 +112,7 @@ func main() {
 								return err
 							}
 
-							rec, err := vole.DhtGet(c.Context, keyBytes, protocol.ID(protoID), ma)
+							rec, err := vole.DhtGet(c.Context, keyBytes, protocol.ID(protoID), ma, dhtOptions(c)...)
 							if err != nil {
 								return err
 							}
@@ -124,7 +120,7 @@ func main() {
 							fmt.Println(enc.Encode(rec.GetValue()))
 							return nil
 						},
-						Flags: []cli.Flag{
+						Flags: append([]cli.Flag{
 							&cli.StringFlag{
 								Name:        "protocolID",
 								Usage:       "the protocol ID",
@@ -138,13 +134,13 @@ func main() {
 								DefaultText: "base32",
 								Value:       "base32",
 							},
-						},
+						}, append(dhtKeyFlags, dhtRequestFlags...)...),
 					},
 					{
 						Name:        "getprovs",
 						ArgsUsage:   "<cid> <multiaddr>",
 						Usage:       "gets provider records from a DHT node",
-						Description: "creates a libp2p peer and sends a DHT get providers request to the target",
+						Description: "creates a libp2p peer and sends a DHT get providers request to the target - with --verify every provider is dialed and checked, printing one JSON result per provider",
 						Action: func(c *cli.Context) error {
 							if c.NArg() != 2 {
 								return fmt.Errorf("invalid number of arguments")
@@ -164,14 +160,22 @@ func main() {
 								return err
 							}
 
-							provs, err := vole.DhtGetProvs(c.Context, dataCID.Hash(), protocol.ID(protoID), ma)
+							if c.Bool("verify") {
+								return verifyProviders(c, dataCID.Hash(), protocol.ID(protoID), ma)
+							}
+
+							provs, err := vole.DhtGetProvs(c.Context, dataCID.Hash(), protocol.ID(protoID), ma, dhtOptions(c)...)
 							if err != nil {
 								return err
 							}
 
-							return printPeerIDs(provs, showAddrs)
+							var target []byte
+							if c.Bool("distance") {
+								target = dataCID.Hash()
+							}
+							return printPeerIDs(provs, showAddrs, target)
 						},
-						Flags: []cli.Flag{
+						Flags: append([]cli.Flag{
 							&cli.StringFlag{
 								Name:        "protocolID",
 								Usage:       "the protocol ID",
@@ -185,40 +189,52 @@ func main() {
 								DefaultText: "false",
 								Value:       false,
 							},
-						},
+							distanceFlag,
+							&cli.BoolFlag{
+								Name:        "verify",
+								Usage:       "dial every provider, identify it and report its reachability, address quality, bitswap support and latency",
+								DefaultText: "false",
+								Value:       false,
+							},
+							&cli.DurationFlag{
+								Name:        "verify-timeout",
+								Usage:       "how long to spend verifying each provider",
+								DefaultText: "15s",
+								Value:       time.Second * 15,
+							},
+						}, dhtRequestFlags...),
 					},
 					{
 						Name:        "gcp",
-						ArgsUsage:   "<multibase-bytes-key> <multiaddr>",
+						ArgsUsage:   "[<multibase-bytes-key>] <multiaddr>",
 						Usage:       "gets the closest peers to the target from a DHT node",
-						Description: "creates a libp2p peer and sends a DHT get closest peers request to the target - prints the peers and their addresses",
+						Description: "creates a libp2p peer and sends a DHT get closest peers request to the target - prints the peers and their addresses - the key can be given as typed flags instead of multibase bytes",
 						Action: func(c *cli.Context) error {
-							if c.NArg() != 2 {
-								return fmt.Errorf("invalid number of arguments")
-							}
-							keyStr := c.Args().Get(0)
-							maStr := c.Args().Get(1)
-							protoID := c.String("protocolID")
-							showAddrs := c.Bool("show-addrs")
-
-							_, keyBytes, err := multibase.Decode(keyStr)
+							keyBytes, args, err := dhtKeyAndArgs(c, 1, vole.DhtKeyPeer)
 							if err != nil {
 								return err
 							}
+							maStr := args[0]
+							protoID := c.String("protocolID")
+							showAddrs := c.Bool("show-addrs")
 
 							ma, err := multiaddr.NewMultiaddr(maStr)
 							if err != nil {
 								return err
 							}
 
-							ais, err := vole.DhtGetClosestPeers(c.Context, keyBytes, protocol.ID(protoID), ma)
+							ais, err := vole.DhtGetClosestPeers(c.Context, keyBytes, protocol.ID(protoID), ma, dhtOptions(c)...)
 							if err != nil {
 								return err
 							}
 
-							return printPeerIDs(ais, showAddrs)
+							var target []byte
+							if c.Bool("distance") {
+								target = keyBytes
+							}
+							return printPeerIDs(ais, showAddrs, target)
 						},
-						Flags: []cli.Flag{
+						Flags: append([]cli.Flag{
 							&cli.StringFlag{
 								Name:        "protocolID",
 								Usage:       "the protocol ID",
@@ -232,7 +248,8 @@ func main() {
 								DefaultText: "false",
 								Value:       false,
 							},
-						},
+							distanceFlag,
+						}, append(dhtKeyFlags, dhtRequestFlags...)...),
 					},
 					{
 						Name:        "ping",
@@ -251,7 +268,7 @@ func main() {
 								return err
 							}
 
-							err = vole.DhtPing(c.Context, protocol.ID(protoID), ma)
+							err = vole.DhtPing(c.Context, protocol.ID(protoID), ma, dhtOptions(c)...)
 							if err != nil {
 								return err
 							}
@@ -259,15 +276,21 @@ func main() {
 							fmt.Println("Ok")
 							return nil
 						},
-						Flags: []cli.Flag{
+						Flags: append([]cli.Flag{
 							&cli.StringFlag{
 								Name:        "protocolID",
 								Usage:       "the protocol ID",
 								DefaultText: "/ipfs/kad/1.0.0",
 								Value:       "/ipfs/kad/1.0.0",
 							},
-						},
+						}, dhtRequestFlags...),
 					},
+					dhtShellCmd,
+					dhtKeyCmd,
+					dhtServeCmd,
+					dhtCheckCmd,
+					dhtWatchCmd,
+					dhtModeCmd,
 				},
 			},
 			{
@@ -302,35 +325,135 @@ func main() {
 				Subcommands: []*cli.Command{
 					{
 						Name:      "identify",
-						ArgsUsage: "<multiaddr>",
+						ArgsUsage: "<multiaddr>...",
 						Flags: []cli.Flag{
 							&cli.BoolFlag{
 								Name: "allow-unknown-peer",
 								Usage: `if the multiaddr does not end with /p2p/PeerID allow trying to determine the peerID at the destination.
 Note: connecting to a peer without knowing its peerID is generally insecure, however it is situationally useful.
-Note: may not work with some transports such as p2p-circuit (not applicable) and webtransport (requires certificate hashes).
+Note: does not work with p2p-circuit addresses, as the relay needs the peerID. WebTransport addresses without certificate hashes
+are dialed with the hashes the peer advertises over QUIC on the same port. Secure WebSocket addresses need a certificate that verifies.
 `,
 								DefaultText: "false",
 								Value:       false,
 							},
+							&cli.BoolFlag{
+								Name:        "json",
+								Usage:       "print the identify result as JSON, always the case when identifying several peers",
+								DefaultText: "false",
+								Value:       false,
+							},
+							&cli.StringFlag{
+								Name:  "format",
+								Usage: "print the identify result using a Go template, e.g. '{{.AgentVersion}}'",
+							},
+							&cli.StringFlag{
+								Name:    "file",
+								Aliases: []string{"f"},
+								Usage:   "read multiaddrs to identify from a file, one per line, - for stdin",
+							},
+							&cli.IntFlag{
+								Name:        "concurrency",
+								Usage:       "how many peers to identify at a time when identifying several",
+								DefaultText: "32",
+								Value:       32,
+							},
+							&cli.DurationFlag{
+								Name:        "timeout",
+								Usage:       "how long to spend identifying each peer when identifying several",
+								DefaultText: "30s",
+								Value:       time.Second * 30,
+							},
+							&cli.BoolFlag{
+								Name:        "probe",
+								Usage:       "negotiate every advertised protocol and a list of well-known ones to find out which the peer actually speaks",
+								DefaultText: "false",
+								Value:       false,
+							},
+							&cli.StringSliceFlag{
+								Name:        "probe-protocol",
+								Usage:       "protocol to probe for in addition to the advertised ones, may be repeated",
+								DefaultText: "well-known bitswap, kad, ping, identify, autonat, relay, dcutr, fetch and pubsub protocols",
+							},
+							&cli.BoolFlag{
+								Name:        "watch",
+								Usage:       "stay connected and print what changes whenever the peer sends an identify-push, until interrupted",
+								DefaultText: "false",
+								Value:       false,
+							},
+							&cli.DurationFlag{
+								Name:        "reconnect-interval",
+								Usage:       "how often to try to reconnect to a watched peer after it disconnects",
+								DefaultText: "5s",
+								Value:       time.Second * 5,
+							},
 						},
-						Usage:       "learn about the peer with the given multiaddr",
-						Description: "connects to the target address and runs identify against the peer",
+						Usage: "learn about the peer with the given multiaddr",
+						Description: `connects to the target address and runs identify against the peer.
+When several multiaddrs are given, as arguments or with --file, they are identified concurrently from a single libp2p peer
+and one JSON result is printed per line as each finishes, including failures and how long each took.
+With --watch a single peer is identified and its protocol, address and version changes are printed as they happen.
+With --probe every advertised protocol, plus a list of well-known ones, is negotiated to find out which the peer actually speaks.`,
 						Action: func(c *cli.Context) error {
-							if c.NArg() != 1 {
-								return fmt.Errorf("invalid number of arguments")
+							if c.Bool("json") && c.IsSet("format") {
+								return fmt.Errorf("json and format cannot be used together")
 							}
 							allowUnknownPeer := c.Bool("allow-unknown-peer")
-							resp, err := vole.IdentifyRequest(c.Context, c.Args().First(), allowUnknownPeer)
+							if c.Bool("watch") {
+								if c.IsSet("format") || c.Bool("probe") {
+									return fmt.Errorf("watch cannot be used with format or probe")
+								}
+								return watchIdentify(c, allowUnknownPeer)
+							}
+							if c.NArg() != 1 || c.IsSet("file") {
+								if c.IsSet("format") {
+									return fmt.Errorf("format cannot be used when identifying several peers, their results are always printed as JSON")
+								}
+								return identifyMany(c, allowUnknownPeer)
+							}
+							resp, err := vole.IdentifyRequest(c.Context, c.Args().First(), allowUnknownPeer, identifyOptions(c)...)
 							if err != nil {
 								return err
 							}
 
+							if c.Bool("json") {
+								return json.NewEncoder(os.Stdout).Encode(resp)
+							}
+							if f := c.String("format"); f != "" {
+								tmpl, err := template.New("format").Parse(f)
+								if err != nil {
+									return err
+								}
+								if err := tmpl.Execute(os.Stdout, resp); err != nil {
+									return err
+								}
+								fmt.Println()
+								return nil
+							}
+
 							fmt.Printf("PeerID: %q\n", resp.PeerId)
 							fmt.Printf("Protocol version: %q\n", resp.ProtocolVersion)
 							fmt.Printf("Agent version: %q\n", resp.AgentVersion)
+							fmt.Printf("Public key type: %q\n", resp.PublicKeyType)
+							fmt.Printf("Public key: %q\n", crypto.ConfigEncodeKey(resp.PublicKey))
+							if resp.ConnectedAddr != nil {
+								fmt.Printf("Connected address: %s\n", formatClassifiedAddr(*resp.ConnectedAddr))
+							}
+							if resp.ObservedAddr != nil {
+								fmt.Printf("Observed address: %s\n", formatClassifiedAddr(*resp.ObservedAddr))
+							}
+							if resp.MessageError != nil {
+								fmt.Printf("Identify message: could not be requested again: %v\n", resp.MessageError)
+							} else {
+								printPeerRecord(resp.PeerRecord)
+							}
 
 							fmt.Println("Listen addresses:")
+							for _, a := range resp.ListenAddrs {
+								fmt.Printf("\t- %s\n", formatClassifiedAddr(a))
+							}
+
+							fmt.Println("Peerstore addresses:")
 							for _, a := range resp.Addresses {
 								fmt.Printf("\t- %q\n", a)
 							}
@@ -339,6 +462,10 @@ Note: may not work with some transports such as p2p-circuit (not applicable) and
 							for _, p := range resp.Protocols {
 								fmt.Printf("\t- %q\n", p)
 							}
+
+							if resp.ProtocolProbes != nil {
+								printProtocolProbes(resp.ProtocolProbes)
+							}
 							return nil
 						},
 					}, {
@@ -348,13 +475,51 @@ Note: may not work with some transports such as p2p-circuit (not applicable) and
 
 							&cli.BoolFlag{
 								Name:        "force-relay",
-								Usage:       `Ping the peer over a relay instead of a direct connection`,
+								Usage:       `Ping the peer over a relay instead of a direct connection, through the --relay relays when given a direct address`,
+								DefaultText: "false",
+								Value:       false,
+							},
+							&cli.IntFlag{
+								Name:        "count",
+								Aliases:     []string{"c"},
+								Usage:       "how many pings to send, 0 to ping until interrupted",
+								DefaultText: "3",
+								Value:       3,
+							},
+							&cli.DurationFlag{
+								Name:        "interval",
+								Aliases:     []string{"i"},
+								Usage:       "time between sending two pings",
+								DefaultText: "1s",
+								Value:       time.Second,
+							},
+							&cli.DurationFlag{
+								Name:        "timeout",
+								Usage:       "how long to wait for each reply before counting the ping as lost",
+								DefaultText: "10s",
+								Value:       time.Second * 10,
+							},
+							&cli.BoolFlag{
+								Name:        "json",
+								Usage:       "print every ping and the summary as a JSON object per line",
+								DefaultText: "false",
+								Value:       false,
+							},
+							&cli.BoolFlag{
+								Name:        "each-addr",
+								Usage:       "ping over every address the peer listens on, each on a connection of its own, and compare the transports",
 								DefaultText: "false",
 								Value:       false,
 							},
 						},
-						Usage:       "ping a peer",
-						Description: "connects to the target address and pings",
+						Usage: "ping a peer",
+						Description: `connects to the target address and pings, then prints the RTT statistics and packet loss like the ping tool,
+followed by the details of the connection the pings went over.
+With --each-addr the peer is identified to learn its addresses, then pinged from a new libp2p peer over each address in turn,
+and a table of the connect time, handshake time and RTTs of every transport is printed.
+Failures are reported as dial, negotiation, timeout, reset, short read, mismatch or other errors.
+When pinging fails, or any ping is lost, vole exits with the code of the last failure:
+1 other, 2 dial, 3 negotiation, 4 timeout, 5 reset, 6 short read, 7 mismatch.`,
 						Action: func(c *cli.Context) error {
 							if c.NArg() != 1 {
 								return fmt.Errorf("invalid number of arguments")
@@ -364,14 +529,51 @@ Note: may not work with some transports such as p2p-circuit (not applicable) and
 							if err != nil {
 								return err
 							}
-							return vole.Ping(c.Context, c.Bool("force-relay"), ai)
+							if c.Bool("each-addr") {
+								if c.Bool("force-relay") {
+									return fmt.Errorf("each-addr and force-relay cannot be used together")
+								}
+								return runPingEachAddr(c, ai)
+							}
+							return runPing(c, ai)
 						},
 					}, {
-						Name:        "connect",
-						ArgsUsage:   "<multiaddr>",
-						Flags:       []cli.Flag{},
-						Usage:       "connect to a peer",
-						Description: "connects to the target address and pings",
+						Name:      "connect",
+						ArgsUsage: "<multiaddr>",
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:        "holepunch-timeout",
+								Usage:       "how long to wait for a peer connected to over a relay to hole punch a direct connection",
+								DefaultText: "30s",
+								Value:       time.Second * 30,
+							},
+							&cli.BoolFlag{
+								Name:        "phases",
+								Usage:       "instead of connecting once, dial each address separately and time every phase of the connection setup",
+								DefaultText: "false",
+								Value:       false,
+							},
+							&cli.DurationFlag{
+								Name:        "timeout",
+								Usage:       "how long to give each address when timing the connection setup phases",
+								DefaultText: "10s",
+								Value:       time.Second * 10,
+							},
+							&cli.BoolFlag{
+								Name:        "json",
+								Usage:       "with --phases, print the phases of every address as a JSON object per line",
+								DefaultText: "false",
+								Value:       false,
+							},
+						},
+						Usage: "connect to a peer",
+						Description: `connects to the target address and pings, printing how long connecting took and the details of the connection.
+When the connection is relayed, vole first waits for the DCUtR hole punch and prints whether it succeeded,
+how many attempts it took and how long, which addresses were tried and whether the connection ended up direct.
+With --phases every address is dialed on its own and the time spent resolving DNS, in the transport handshake, the security handshake,
+negotiating the muxer and opening the first stream is printed for each, as a table or with --json a JSON object per line. TCP connections are timed phase by phase, other transports
+handle security and multiplexing themselves or are dialed as a whole, so their transport handshake includes those phases.
+When the muxer is agreed on during the security handshake, as TLS and Noise do when both sides support it, the security handshake includes it.`,
 						Action: func(c *cli.Context) error {
 							if c.NArg() != 1 {
 								return fmt.Errorf("invalid number of arguments")
@@ -381,7 +583,13 @@ Note: may not work with some transports such as p2p-circuit (not applicable) and
 							if err != nil {
 								return err
 							}
-							return vole.OnlyConnect(c.Context, ai)
+							if c.Bool("phases") {
+								return runConnectPhases(c, ai)
+							}
+							if c.Bool("json") {
+								return fmt.Errorf("json can only be used with phases")
+							}
+							return vole.OnlyConnect(c.Context, ai, vole.ConnectHolePunchTimeout(c.Duration("holepunch-timeout")))
 						},
 					},
 				},
@@ -395,19 +603,34 @@ Note: may not work with some transports such as p2p-circuit (not applicable) and
 	}
 }
 
-func printPeerIDs(ais []*peer.AddrInfo, showAddrs bool) error {
+// printPeerIDs prints the peers, annotated with their kademlia distance to the target key when it is not nil
+func printPeerIDs(ais []*peer.AddrInfo, showAddrs bool, target []byte) error {
 	for _, a := range ais {
 		if showAddrs {
 			b, err := a.MarshalJSON()
 			if err != nil {
 				return err
 			}
+			if target != nil {
+				var m map[string]interface{}
+				if err := json.Unmarshal(b, &m); err != nil {
+					return err
+				}
+				m["CommonPrefixLen"] = vole.KadCommonPrefixLen([]byte(a.ID), target)
+				m["Distance"] = hex.EncodeToString(vole.KadDistance([]byte(a.ID), target))
+				b, err = json.Marshal(m)
+				if err != nil {
+					return err
+				}
+			}
 			var pretty bytes.Buffer
 			err = json.Indent(&pretty, b, "", "\t")
 			if err != nil {
 				return err
 			}
 			fmt.Println(pretty.String())
+		} else if target != nil {
+			fmt.Printf("%s\tcpl=%d\tdistance=%s\n", a.ID, vole.KadCommonPrefixLen([]byte(a.ID), target), hex.EncodeToString(vole.KadDistance([]byte(a.ID), target)))
 		} else {
 			fmt.Println(a.ID)
 		}
@@ -416,6 +639,101 @@ func printPeerIDs(ais []*peer.AddrInfo, showAddrs bool) error {
 	return nil
 }
 
+// verifyProviders gets the providers of the key from the DHT node and prints the result of verifying each one as a line of JSON
+func verifyProviders(c *cli.Context, key []byte, proto protocol.ID, ma multiaddr.Multiaddr) error {
+	ai, err := peer.AddrInfoFromP2pAddr(ma)
+	if err != nil {
+		return err
+	}
+
+	client, err := vole.NewDhtClient(c.Context, proto, ai, dhtOptions(c)...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	provs, err := client.GetProvs(c.Context, key)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range client.VerifyProviders(c.Context, provs, c.Duration("verify-timeout")) {
+		jsOut, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", jsOut)
+	}
+	return nil
+}
+
+var distanceFlag = &cli.BoolFlag{
+	Name:        "distance",
+	Aliases:     []string{"d"},
+	Usage:       "annotate each peer with the common prefix length and XOR distance between its kademlia ID and the target key's",
+	DefaultText: "false",
+	Value:       false,
+}
+
+var dhtRequestFlags = []cli.Flag{
+	&cli.DurationFlag{
+		Name:        "timeout",
+		Usage:       "how long to wait for the response to a request",
+		DefaultText: "5s",
+		Value:       time.Second * 5,
+		Action: func(_ *cli.Context, d time.Duration) error {
+			if d <= 0 {
+				return fmt.Errorf("invalid timeout %s, must be positive", d)
+			}
+			return nil
+		},
+	},
+	&cli.DurationFlag{
+		Name:        "stream-timeout",
+		Usage:       "how long to wait for a stream to the peer to open, 0 waits as long as the request is allowed to run",
+		DefaultText: "0s",
+		Value:       0,
+	},
+	&cli.IntFlag{
+		Name:        "retries",
+		Usage:       "how many times to retry a failed request on a fresh stream, every attempt is reported on stderr",
+		DefaultText: "0",
+		Value:       0,
+		Action: func(_ *cli.Context, n int) error {
+			if n < 0 {
+				return fmt.Errorf("invalid number of retries %d, must not be negative", n)
+			}
+			return nil
+		},
+	},
+	&cli.DurationFlag{
+		Name:        "retry-backoff",
+		Usage:       "how long to wait before the first retry, doubles after every further attempt",
+		DefaultText: "1s",
+		Value:       time.Second,
+	},
+}
+
+func dhtOptions(c *cli.Context) []vole.DhtOption {
+	opts := []vole.DhtOption{
+		vole.DhtRequestTimeout(c.Duration("timeout")),
+		vole.DhtStreamOpenTimeout(c.Duration("stream-timeout")),
+		vole.DhtRetries(c.Int("retries"), c.Duration("retry-backoff")),
+	}
+	if c.Int("retries") > 0 {
+		opts = append(opts, vole.DhtAttemptReporter(printDhtAttempt))
+	}
+	return opts
+}
+
+func printDhtAttempt(a vole.DhtAttempt) {
+	if a.Err != nil {
+		fmt.Fprintf(os.Stderr, "%s to %s: attempt %d/%d failed after %s: %v\n", a.Type, a.Peer, a.Attempt, a.MaxAttempts, a.Duration, a.Err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s to %s: attempt %d/%d succeeded after %s\n", a.Type, a.Peer, a.Attempt, a.MaxAttempts, a.Duration)
+}
+
 var bitswapGetCmd = &cli.Command{
 	Name: "get",
 	Action: func(cctx *cli.Context) error {
@@ -485,3 +803,39 @@ var bitswapCheckCmd = &cli.Command{
 		},
 	},
 }
+
+func formatClassifiedAddr(a vole.ClassifiedAddr) string {
+	transport := a.Transport
+	if transport == "" {
+		transport = "unknown transport"
+	}
+	return fmt.Sprintf("%q (%s, %s)", a.Addr, a.Scope, transport)
+}
+
+func printPeerRecord(rec *vole.PeerRecordInfo) {
+	if rec == nil {
+		fmt.Println("Signed peer record: none")
+		return
+	}
+	if rec.Malformed {
+		fmt.Printf("Signed peer record: invalid: %v\n", rec.Error)
+		return
+	}
+	fmt.Println("Signed peer record:")
+	fmt.Printf("\tSequence: %d\n", rec.Seq)
+	if rec.SignatureValid {
+		fmt.Println("\tSignature: valid")
+	} else {
+		fmt.Printf("\tSignature: invalid: %v\n", rec.Error)
+	}
+	fmt.Println("\tAddresses:")
+	for _, a := range rec.Addrs {
+		fmt.Printf("\t\t- %q\n", a)
+	}
+	for _, a := range rec.UnsignedListenAddrs {
+		fmt.Printf("\tMismatch: listen address %q is not in the signed record\n", a)
+	}
+	for _, a := range rec.UnadvertisedSignedAddrs {
+		fmt.Printf("\tMismatch: signed address %q is not a listen address\n", a)
+	}
+}
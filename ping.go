@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	vole "github.com/ipfs-shipyard/vole/lib"
+	"github.com/urfave/cli/v2"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// pingExitCodes are the exit codes of the ping command for each kind of failure
+var pingExitCodes = map[vole.PingErrorKind]int{
+	vole.PingErrorOther:       1,
+	vole.PingErrorDial:        2,
+	vole.PingErrorNegotiation: 3,
+	vole.PingErrorTimeout:     4,
+	vole.PingErrorReset:       5,
+	vole.PingErrorShortRead:   6,
+	vole.PingErrorMismatch:    7,
+}
+
+// pingExit turns a ping error into an error that makes vole exit with the code of its kind
+func pingExit(err error, message string) error {
+	return cli.Exit(message, pingExitCodes[vole.PingErrorKindOf(err)])
+}
+
+// runPing pings the peer as configured by the flags of the ping command, stopping early when interrupted
+func runPing(c *cli.Context, ai *peer.AddrInfo) error {
+	if c.Int("count") < 0 {
+		return fmt.Errorf("count must not be negative")
+	}
+	if c.Duration("interval") <= 0 || c.Duration("timeout") <= 0 {
+		return fmt.Errorf("interval and timeout must be positive")
+	}
+
+	ctx, cancel := signal.NotifyContext(c.Context, os.Interrupt)
+	defer cancel()
+
+	enc := json.NewEncoder(os.Stdout)
+	asJSON := c.Bool("json")
+	var lastErr error
+	stats, err := vole.PingPeer(ctx, c.Bool("force-relay"), ai,
+		vole.PingCount(c.Int("count")),
+		vole.PingInterval(c.Duration("interval")),
+		vole.PingTimeout(c.Duration("timeout")),
+		vole.PingReporter(func(r vole.PingResult) {
+			if r.Error != nil {
+				lastErr = r.Error
+			}
+			switch {
+			case asJSON:
+				_ = enc.Encode(r)
+			case r.Error != nil:
+				fmt.Printf("seq=%d %v\n", r.Seq, r.Error)
+			default:
+				fmt.Printf("seq=%d time=%s\n", r.Seq, r.RTT)
+			}
+		}),
+	)
+	if err != nil {
+		return pingExit(err, err.Error())
+	}
+
+	// lost pings make the command fail like the last one that was lost
+	if asJSON {
+		if err := enc.Encode(stats); err != nil {
+			return err
+		}
+		if lastErr != nil {
+			return pingExit(lastErr, "")
+		}
+		return nil
+	}
+	fmt.Printf("--- %s ping statistics ---\n", stats.Peer)
+	fmt.Printf("%d pings sent, %d received, %.1f%% loss\n", stats.Sent, stats.Received, stats.Loss)
+	if stats.Received > 0 {
+		fmt.Printf("rtt min/avg/max/stddev = %s/%s/%s/%s, jitter = %s\n", stats.Min, stats.Avg, stats.Max, stats.StdDev, stats.Jitter)
+	}
+	stats.Conn.Print()
+	if lastErr != nil {
+		return pingExit(lastErr, "")
+	}
+	return nil
+}
+
+// runPingEachAddr learns the addresses the peer listens on with identify, then pings it over each of them separately
+func runPingEachAddr(c *cli.Context, ai *peer.AddrInfo) error {
+	if c.Int("count") <= 0 {
+		return fmt.Errorf("count must be positive when pinging each address")
+	}
+	if c.Duration("interval") <= 0 || c.Duration("timeout") <= 0 {
+		return fmt.Errorf("interval and timeout must be positive")
+	}
+
+	ctx, cancel := signal.NotifyContext(c.Context, os.Interrupt)
+	defer cancel()
+
+	info, err := vole.IdentifyRequest(ctx, c.Args().First(), false)
+	if err != nil {
+		err = &vole.PingError{Kind: vole.PingErrorDial, Err: fmt.Errorf("learning the addresses of the peer: %w", err)}
+		return pingExit(err, err.Error())
+	}
+	addrs := append([]multiaddr.Multiaddr{}, ai.Addrs...)
+	for _, la := range info.ListenAddrs {
+		if !multiaddr.Contains(addrs, la.Addr) {
+			addrs = append(addrs, la.Addr)
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	asJSON := c.Bool("json")
+	var results []*vole.AddrPingResult
+	var lastErr error
+	vole.PingAddrs(ctx, &peer.AddrInfo{ID: ai.ID, Addrs: addrs}, func(r *vole.AddrPingResult) {
+		if r.Error != nil {
+			lastErr = r.Error
+		}
+		if asJSON {
+			_ = enc.Encode(r)
+			return
+		}
+		results = append(results, r)
+	},
+		vole.PingCount(c.Int("count")),
+		vole.PingInterval(c.Duration("interval")),
+		vole.PingTimeout(c.Duration("timeout")),
+	)
+	if !asJSON {
+		printAddrPingResults(results)
+	}
+	if lastErr != nil {
+		return pingExit(lastErr, "")
+	}
+	return nil
+}
+
+func printAddrPingResults(results []*vole.AddrPingResult) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TRANSPORT\tADDRESS\tCONNECT\tHANDSHAKE\tRTT MIN/AVG/MAX\tLOSS")
+	for _, r := range results {
+		if r.Error != nil {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Transport, r.Addr, oneLineErr(r.Error))
+			continue
+		}
+		rtt := "-"
+		if r.Stats.Received > 0 {
+			rtt = fmt.Sprintf("%s/%s/%s", r.Stats.Min, r.Stats.Avg, r.Stats.Max)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%.1f%%\n", r.Transport, r.Addr, r.ConnectTime, r.HandshakeTime, rtt, r.Stats.Loss)
+	}
+	_ = tw.Flush()
+}